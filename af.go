@@ -0,0 +1,432 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Population allele frequency analysis
+// ------------------------------------------------------------------
+//
+// The neomer tables carry gnomAD-style allele frequencies of the
+// creating variant: AF overall and AF_<population> per ancestry. A
+// neomer's AF in a population is the maximum over its rows. A neomer is
+// classed "germline" (germline-polymorphism-associated) when any AF
+// column exceeds the threshold, and "somatic" (somatic-only) otherwise,
+// including when no AF is recorded.
+
+var afColumns = []string{"AF", "AF_eas", "AF_afr", "AF_fin", "AF_ami", "AF_amr", "AF_nfe", "AF_sas", "AF_asj"}
+
+// presentAFColumns returns the AF columns that exist in a table.
+func presentAFColumns(table string) ([]string, error) {
+    cols, err := tableColumns(table)
+    if err != nil {
+        return nil, err
+    }
+    var present []string
+    for _, col := range afColumns {
+        if cols[col] {
+            present = append(present, col)
+        }
+    }
+    return present, nil
+}
+
+// perNeomerAFSQL returns a SELECT of one row per neomer with its maximum
+// AF in every given column.
+func perNeomerAFSQL(table string, cols []string) string {
+    parts := make([]string, len(cols))
+    for i, col := range cols {
+        parts[i] = fmt.Sprintf(`MAX(TRY_CAST("%[1]s" AS DOUBLE)) AS "%[1]s"`, col)
+    }
+    return fmt.Sprintf(`
+        SELECT nullomers_created, %s
+        FROM %s
+        GROUP BY nullomers_created
+    `, strings.Join(parts, ", "), table)
+}
+
+// afTableParams resolves the dataset/K parameters to the neomer table
+// and its AF columns.
+func afTableParams(c *gin.Context) (string, int, string, []string, bool) {
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return "", 0, "", nil, false
+    }
+    prefix, _ := neomerTablePrefix(dataset)
+    table := fmt.Sprintf("%s%d", prefix, k)
+    cols, err := presentAFColumns(table)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return "", 0, "", nil, false
+    }
+    if len(cols) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s has no AF columns", table)})
+        return "", 0, "", nil, false
+    }
+    return dataset, k, table, cols, true
+}
+
+// ------------------------------------------------------------------
+// getAFHistogramHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /af_histogram?K=16&dataset=genome&bins=20&scale=linear[&populations=AF_eas,AF_afr]
+//
+// Per-population histogram of neomer AF. Neomers with AF = 0 and with
+// no AF are counted separately ("zero", "missing"); the remaining
+// values are binned over (0, 1] linearly or, with scale=log, over
+// log10(AF) in [-6, 0].
+//
+func getAFHistogramHandler(c *gin.Context) {
+    dataset, k, table, cols, ok := afTableParams(c)
+    if !ok {
+        return
+    }
+    if p := c.Query("populations"); p != "" {
+        present := map[string]bool{}
+        for _, col := range cols {
+            present[col] = true
+        }
+        cols = nil
+        for _, col := range strings.Split(p, ",") {
+            col = strings.TrimSpace(col)
+            if !present[col] {
+                c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown AF column '%s'", col)})
+                return
+            }
+            cols = append(cols, col)
+        }
+    }
+    bins := 20
+    if b, err := strconv.Atoi(c.Query("bins")); err == nil && b > 0 && b <= 200 {
+        bins = b
+    }
+    scale := c.DefaultQuery("scale", "linear")
+    const minLog = -6.0
+    var binExpr string
+    switch scale {
+    case "linear":
+        binExpr = fmt.Sprintf("LEAST(CAST(FLOOR(af * %d) AS INTEGER), %d)", bins, bins-1)
+    case "log":
+        binExpr = fmt.Sprintf("GREATEST(LEAST(CAST(FLOOR((LOG10(af) - (%g)) / %g * %d) AS INTEGER), %d), 0)", minLog, -minLog, bins, bins-1)
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'scale' must be 'linear' or 'log'"})
+        return
+    }
+
+    quoted := make([]string, len(cols))
+    for i, col := range cols {
+        quoted[i] = `"` + col + `"`
+    }
+    query := fmt.Sprintf(`
+        WITH per AS (%s),
+        long AS (
+            SELECT * FROM per UNPIVOT INCLUDE NULLS (af FOR population IN (%s))
+        )
+        SELECT
+            population,
+            CASE WHEN af IS NULL THEN -2 WHEN af <= 0 THEN -1 ELSE %s END AS bin,
+            COUNT(*) AS num_neomers
+        FROM long
+        GROUP BY population, bin
+    `, perNeomerAFSQL(table, cols), strings.Join(quoted, ", "), binExpr)
+    rows, err := db.Query(query)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    type afBin struct {
+        Lower float64 `json:"lower"`
+        Upper float64 `json:"upper"`
+        Count int64   `json:"count"`
+    }
+    type afHistogram struct {
+        Population string  `json:"population"`
+        Zero       int64   `json:"zero"`
+        Missing    int64   `json:"missing"`
+        Bins       []afBin `json:"bins"`
+    }
+    histograms := make([]*afHistogram, len(cols))
+    byPop := map[string]*afHistogram{}
+    for i, col := range cols {
+        h := &afHistogram{Population: col, Bins: make([]afBin, bins)}
+        for b := range h.Bins {
+            if scale == "log" {
+                h.Bins[b].Lower = math.Pow(10, minLog-minLog*float64(b)/float64(bins))
+                h.Bins[b].Upper = math.Pow(10, minLog-minLog*float64(b+1)/float64(bins))
+            } else {
+                h.Bins[b].Lower = float64(b) / float64(bins)
+                h.Bins[b].Upper = float64(b+1) / float64(bins)
+            }
+        }
+        histograms[i] = h
+        byPop[col] = h
+    }
+    for rows.Next() {
+        var pop string
+        var bin int
+        var n int64
+        if err := rows.Scan(&pop, &bin, &n); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        h := byPop[pop]
+        switch {
+        case h == nil:
+        case bin == -2:
+            h.Missing += n
+        case bin == -1:
+            h.Zero += n
+        case bin >= 0 && bin < bins:
+            h.Bins[bin].Count += n
+        }
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":          k,
+        "dataset":    dataset,
+        "scale":      scale,
+        "histograms": histograms,
+    })
+}
+
+// ------------------------------------------------------------------
+// getPopulationSpecificNeomersHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /population_specific_neomers?K=16&dataset=genome&population=AF_eas
+//                                       &minAF=0.01&maxOtherAF=0&page=0&limit=100
+//
+// Neomers with AF >= minAF in one ancestry and AF <= maxOtherAF (or no
+// AF) in every other ancestry. The overall AF column is not treated as
+// an ancestry.
+//
+func getPopulationSpecificNeomersHandler(c *gin.Context) {
+    dataset, k, table, cols, ok := afTableParams(c)
+    if !ok {
+        return
+    }
+    population := c.Query("population")
+    var others []string
+    found := false
+    for _, col := range cols {
+        if col == population {
+            found = true
+        } else if col != "AF" {
+            others = append(others, col)
+        }
+    }
+    if !found || population == "AF" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Parameter 'population' must be one of the AF_<ancestry> columns of %s", table)})
+        return
+    }
+    minAF := 0.01
+    if v, err := strconv.ParseFloat(c.Query("minAF"), 64); err == nil && v >= 0 {
+        minAF = v
+    }
+    maxOtherAF := 0.0
+    if v, err := strconv.ParseFloat(c.Query("maxOtherAF"), 64); err == nil && v >= 0 {
+        maxOtherAF = v
+    }
+    page := 0
+    limit := 100
+    if p, err := strconv.Atoi(c.Query("page")); err == nil && p >= 0 {
+        page = p
+    }
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 10000 {
+        limit = l
+    }
+
+    conds := []string{fmt.Sprintf(`"%s" >= ?`, population)}
+    args := []interface{}{minAF}
+    for _, col := range others {
+        conds = append(conds, fmt.Sprintf(`COALESCE("%s", 0) <= ?`, col))
+        args = append(args, maxOtherAF)
+    }
+    where := "WHERE " + strings.Join(conds, " AND ")
+
+    var totalCount int
+    countQuery := fmt.Sprintf(`WITH per AS (%s) SELECT COUNT(*) FROM per %s`, perNeomerAFSQL(table, cols), where)
+    if err := db.QueryRow(countQuery, args...).Scan(&totalCount); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    query := fmt.Sprintf(`
+        WITH per AS (%s),
+        donors AS (
+            SELECT nullomers_created, COUNT(DISTINCT Donor_ID) AS donors
+            FROM %s
+            GROUP BY nullomers_created
+        )
+        SELECT per.*, donors.donors
+        FROM per
+        JOIN donors USING (nullomers_created)
+        %s
+        ORDER BY "%s" DESC, nullomers_created
+        LIMIT %d OFFSET %d
+    `, perNeomerAFSQL(table, cols), table, where, population, limit, page*limit)
+    headers, data, err := queryTable(query, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":          k,
+        "dataset":    dataset,
+        "population": population,
+        "headers":    headers,
+        "data":       data,
+        "totalCount": totalCount,
+    })
+}
+
+// ------------------------------------------------------------------
+// getAFClassificationHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /af_classification?K=16&dataset=genome&threshold=0
+//                             [&class=germline|somatic&page=0&limit=100]
+//
+// Classifies neomers as germline-polymorphism-associated (max AF over
+// all AF columns > threshold) or somatic-only. Returns class counts
+// overall and per cancer type; with "class" it also lists the neomers
+// of that class.
+//
+func getAFClassificationHandler(c *gin.Context) {
+    dataset, k, table, cols, ok := afTableParams(c)
+    if !ok {
+        return
+    }
+    threshold := 0.0
+    if v, err := strconv.ParseFloat(c.Query("threshold"), 64); err == nil && v >= 0 {
+        threshold = v
+    }
+    class := c.Query("class")
+    if class != "" && class != "germline" && class != "somatic" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'class' must be 'germline' or 'somatic'"})
+        return
+    }
+    source, _ := neomerSourceSQL(dataset, k)
+
+    quoted := make([]string, len(cols))
+    for i, col := range cols {
+        quoted[i] = fmt.Sprintf(`COALESCE("%s", 0)`, col)
+    }
+    maxExpr := quoted[0]
+    if len(quoted) > 1 {
+        maxExpr = "GREATEST(" + strings.Join(quoted, ", ") + ")"
+    }
+    classCTE := fmt.Sprintf(`
+        per AS (%s),
+        classes AS (
+            SELECT
+                nullomers_created,
+                %s AS max_af,
+                CASE WHEN %s > ? THEN 'germline' ELSE 'somatic' END AS af_class
+            FROM per
+        )
+    `, perNeomerAFSQL(table, cols), maxExpr, maxExpr)
+
+    // —— Counts overall and per cancer type ——
+    summaryQuery := fmt.Sprintf(`
+        WITH src AS (%s), %s
+        SELECT
+            GROUPING(s.Cancer_Type) = 1 AS overall,
+            CASE WHEN GROUPING(s.Cancer_Type) = 1 THEN 'All'
+                 ELSE COALESCE(s.Cancer_Type, 'Unknown') END AS cancer_type,
+            COUNT(DISTINCT s.nullomers_created) FILTER (WHERE cl.af_class = 'germline') AS germline,
+            COUNT(DISTINCT s.nullomers_created) FILTER (WHERE cl.af_class = 'somatic')  AS somatic
+        FROM src s
+        JOIN classes cl USING (nullomers_created)
+        GROUP BY ROLLUP (s.Cancer_Type)
+        ORDER BY GROUPING(s.Cancer_Type) DESC, cancer_type
+    `, source, classCTE)
+    rows, err := db.Query(summaryQuery, threshold)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    type classCounts struct {
+        CancerType string  `json:"cancerType"`
+        Germline   int64   `json:"germline"`
+        Somatic    int64   `json:"somatic"`
+        Fraction   float64 `json:"germlineFraction"`
+    }
+    var overall *classCounts
+    perCancer := []classCounts{}
+    for rows.Next() {
+        var cc classCounts
+        var isOverall bool
+        if err := rows.Scan(&isOverall, &cc.CancerType, &cc.Germline, &cc.Somatic); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        if total := cc.Germline + cc.Somatic; total > 0 {
+            cc.Fraction = float64(cc.Germline) / float64(total)
+        }
+        if isOverall {
+            overall = &cc
+            continue
+        }
+        perCancer = append(perCancer, cc)
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    result := gin.H{
+        "K":         k,
+        "dataset":   dataset,
+        "threshold": threshold,
+        "overall":   overall,
+        "perCancer": perCancer,
+    }
+
+    // —— Optional list of one class ——
+    if class != "" {
+        page := 0
+        limit := 100
+        if p, err := strconv.Atoi(c.Query("page")); err == nil && p >= 0 {
+            page = p
+        }
+        if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 10000 {
+            limit = l
+        }
+        listQuery := fmt.Sprintf(`
+            WITH %s
+            SELECT nullomers_created, max_af, af_class
+            FROM classes
+            WHERE af_class = ?
+            ORDER BY max_af DESC, nullomers_created
+            LIMIT %d OFFSET %d
+        `, classCTE, limit, page*limit)
+        headers, data, err := queryTable(listQuery, threshold, class)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        result["headers"] = headers
+        result["data"] = data
+    }
+
+    c.JSON(http.StatusOK, result)
+}
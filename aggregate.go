@@ -0,0 +1,331 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Aggregation API
+// ------------------------------------------------------------------
+//
+// statsSpec is a validated aggregation over neomerDonorSourceSQL: the
+// group-by columns, the measures, HAVING conditions on the measures,
+// the ordering and the page. Column and measure names are checked
+// against the source before they reach SQL; thresholds are parameters.
+
+type statsMeasure struct {
+    Name string
+    SQL  string
+}
+
+type statsSpec struct {
+    GroupBy    []string
+    Measures   []statsMeasure
+    Having     []string
+    HavingArgs []interface{}
+    OrderBy    []string
+    Limit      int
+    Offset     int
+}
+
+var (
+    havingRe    = regexp.MustCompile(`^([A-Za-z0-9_]+)\s*(>=|<=|!=|=|>|<)\s*(-?[0-9.]+(?:[eE][-+]?[0-9]+)?)$`)
+    statsAggSQL = map[string]string{"min": "MIN", "max": "MAX", "avg": "AVG"}
+)
+
+// parseStatsMeasures reads a comma-separated measure list: count,
+// distinct_donors, distinct_neomers, or min:col / max:col / avg:col of
+// a numeric column (named min_col, ...).
+func parseStatsMeasures(spec string, types map[string]string) ([]statsMeasure, error) {
+    var measures []statsMeasure
+    for _, m := range strings.Split(spec, ",") {
+        m = strings.TrimSpace(m)
+        switch m {
+        case "":
+            continue
+        case "count":
+            measures = append(measures, statsMeasure{"count", "COUNT(*)"})
+            continue
+        case "distinct_donors":
+            measures = append(measures, statsMeasure{"distinct_donors", "COUNT(DISTINCT Actual_Donor_ID)"})
+            continue
+        case "distinct_neomers":
+            measures = append(measures, statsMeasure{"distinct_neomers", "COUNT(DISTINCT nullomers_created)"})
+            continue
+        }
+        parts := strings.SplitN(m, ":", 2)
+        agg, ok := statsAggSQL[parts[0]]
+        if !ok || len(parts) != 2 {
+            return nil, fmt.Errorf("unknown measure '%s'", m)
+        }
+        if !isNumericType(types[parts[1]]) {
+            return nil, fmt.Errorf("measure '%s': '%s' is not a numeric column", m, parts[1])
+        }
+        measures = append(measures, statsMeasure{parts[0] + "_" + parts[1], fmt.Sprintf(`%s(CAST("%s" AS DOUBLE))`, agg, parts[1])})
+    }
+    if len(measures) == 0 {
+        measures = []statsMeasure{{"count", "COUNT(*)"}}
+    }
+    return measures, nil
+}
+
+// parseStatsSpec reads groupBy, measures, having, orderBy, limit and
+// page from the query string.
+func parseStatsSpec(c *gin.Context, types map[string]string) (statsSpec, error) {
+    var spec statsSpec
+    for _, col := range strings.Split(c.Query("groupBy"), ",") {
+        if col = strings.TrimSpace(col); col == "" {
+            continue
+        }
+        if types[col] == "" {
+            return spec, fmt.Errorf("unknown groupBy column '%s'", col)
+        }
+        spec.GroupBy = append(spec.GroupBy, col)
+    }
+    measures, err := parseStatsMeasures(c.Query("measures"), types)
+    if err != nil {
+        return spec, err
+    }
+    spec.Measures = measures
+    byName := map[string]string{}
+    for _, m := range measures {
+        byName[m.Name] = m.SQL
+    }
+
+    // having=count>=5,distinct_donors>=3 on selected measures
+    for _, h := range strings.Split(c.Query("having"), ",") {
+        if h = strings.TrimSpace(h); h == "" {
+            continue
+        }
+        m := havingRe.FindStringSubmatch(h)
+        if m == nil {
+            return spec, fmt.Errorf("cannot parse having condition '%s'", h)
+        }
+        expr, ok := byName[m[1]]
+        if !ok {
+            return spec, fmt.Errorf("having condition '%s' is not on a selected measure", h)
+        }
+        v, err := strconv.ParseFloat(m[3], 64)
+        if err != nil {
+            return spec, fmt.Errorf("cannot parse having condition '%s'", h)
+        }
+        spec.Having = append(spec.Having, fmt.Sprintf("%s %s ?", expr, m[2]))
+        spec.HavingArgs = append(spec.HavingArgs, v)
+    }
+
+    // orderBy=count:desc,Cancer_Type:asc on measures or groupBy columns
+    grouped := map[string]bool{}
+    for _, col := range spec.GroupBy {
+        grouped[col] = true
+    }
+    for _, o := range strings.Split(c.Query("orderBy"), ",") {
+        if o = strings.TrimSpace(o); o == "" {
+            continue
+        }
+        name, dir := o, "DESC"
+        if i := strings.Index(o, ":"); i >= 0 {
+            name, dir = o[:i], strings.ToUpper(o[i+1:])
+        }
+        if dir != "ASC" && dir != "DESC" {
+            return spec, fmt.Errorf("orderBy '%s': direction must be asc or desc", o)
+        }
+        if _, ok := byName[name]; !ok && !grouped[name] {
+            return spec, fmt.Errorf("orderBy '%s' is neither a measure nor a groupBy column", name)
+        }
+        spec.OrderBy = append(spec.OrderBy, fmt.Sprintf(`"%s" %s`, name, dir))
+    }
+    if len(spec.OrderBy) == 0 {
+        spec.OrderBy = []string{fmt.Sprintf(`"%s" DESC`, measures[0].Name)}
+    }
+
+    spec.Limit = 100
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 10000 {
+        spec.Limit = l
+    }
+    if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+        spec.Offset = p * spec.Limit
+    }
+    return spec, nil
+}
+
+// atLeastDonorsCond returns the condition of the listing endpoints'
+// special filter at_least_X_distinct_patients;N over a source query,
+// or "" without it.
+func atLeastDonorsCond(specialFilters, source string) string {
+    n := minDistinctPatients(specialFilters)
+    if n <= 0 {
+        return ""
+    }
+    return fmt.Sprintf(`nullomers_created IN (
+        SELECT nullomers_created FROM (%s)
+        GROUP BY nullomers_created
+        HAVING COUNT(DISTINCT Actual_Donor_ID) >= %d
+    )`, source, n)
+}
+
+// runStats evaluates spec on one neomer table under the listing
+// endpoints' filters and the optional cohort. It writes the error
+// response itself and returns headers, rows and the number of groups
+// before paging.
+func runStats(c *gin.Context, dataset string, k int, source string, spec statsSpec) ([]string, [][]interface{}, int64, bool) {
+    conds, args, err := listingFilterConds(c, dataset, k)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return nil, nil, 0, false
+    }
+    if cond := atLeastDonorsCond(c.Query("specialFilters"), source); cond != "" {
+        conds = append(conds, cond)
+    }
+    cohortWhere, cohortArgs, ok := cohortDonorClause(c, dataset, "Actual_Donor_ID")
+    if !ok {
+        return nil, nil, 0, false
+    }
+    if cohortWhere != "" {
+        conds = append(conds, cohortWhere)
+        args = append(args, cohortArgs...)
+    }
+    whereSQL, groupSQL, havingSQL := "", "", ""
+    if len(conds) > 0 {
+        whereSQL = "WHERE " + strings.Join(conds, " AND ")
+    }
+    var selects []string
+    if len(spec.GroupBy) > 0 {
+        quoted := make([]string, len(spec.GroupBy))
+        for i, col := range spec.GroupBy {
+            quoted[i] = fmt.Sprintf(`"%s"`, col)
+        }
+        selects = append(selects, quoted...)
+        groupSQL = "GROUP BY " + strings.Join(quoted, ", ")
+    }
+    for _, m := range spec.Measures {
+        selects = append(selects, fmt.Sprintf(`%s AS "%s"`, m.SQL, m.Name))
+    }
+    if len(spec.Having) > 0 {
+        havingSQL = "HAVING " + strings.Join(spec.Having, " AND ")
+        args = append(args, spec.HavingArgs...)
+    }
+
+    query := fmt.Sprintf(`
+        SELECT %s, COUNT(*) OVER () AS total_groups
+        FROM (%s)
+        %s
+        %s
+        %s
+        ORDER BY %s
+        LIMIT %d OFFSET %d
+    `, strings.Join(selects, ", "), source, whereSQL, groupSQL, havingSQL,
+        strings.Join(spec.OrderBy, ", "), spec.Limit, spec.Offset)
+    headers, data, err := queryTable(query, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return nil, nil, 0, false
+    }
+
+    // Split off the window count
+    var total int64
+    last := len(headers) - 1
+    for i, row := range data {
+        if v, ok := row[last].(int64); ok {
+            total = v
+        }
+        data[i] = row[:last]
+    }
+    return headers[:last], data, total, true
+}
+
+// ------------------------------------------------------------------
+// getStatsHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /stats?dataset=genome&K=16&groupBy=Cancer_Type,Hugo_Symbol
+//                 &measures=count,distinct_donors,avg:AF
+//                 &having=distinct_donors>=3&orderBy=distinct_donors:desc
+//                 &limit=100&page=0
+//                 [&filters=...&column=...&filterType=between&value=...
+//                  &specialFilters=...&cohort=...]
+//
+// Aggregates the rows of neomers_K / exome_neomers_K, joined with the
+// donor's cancer type, organ and clinical data, matching the listing
+// endpoints' filters. groupBy columns and min/max/avg columns are
+// validated against that schema. having conditions compare selected
+// measures with numbers; orderBy takes measures or groupBy columns
+// (default: first measure, descending). Without groupBy the measures
+// are computed over all matching rows.
+//
+func getStatsHandler(c *gin.Context) {
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    source, types, err := neomerDonorSourceSQL(dataset, k)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    spec, err := parseStatsSpec(c, types)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    headers, data, total, ok := runStats(c, dataset, k, source, spec)
+    if !ok {
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "K":           k,
+        "dataset":     dataset,
+        "headers":     headers,
+        "data":        data,
+        "totalGroups": total,
+    })
+}
+
+// legacyStatsHandler serves /get_nullomers_stats and
+// /get_exome_nullomers_stats on top of runStats: rows per neomer and
+// the "groupBy" columns as total_count, the "topN" largest first.
+func legacyStatsHandler(c *gin.Context, dataset string) {
+    k, err := strconv.Atoi(c.Query("length"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required parameter 'length'"})
+        return
+    }
+    source, types, err := neomerDonorSourceSQL(dataset, k)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    spec := statsSpec{
+        GroupBy:  []string{"nullomers_created"},
+        Measures: []statsMeasure{{"total_count", "COUNT(*)"}},
+        OrderBy:  []string{`"total_count" DESC`},
+        Limit:    10,
+    }
+    if n, err := strconv.Atoi(c.Query("topN")); err == nil && n > 0 {
+        spec.Limit = n
+    }
+    for _, col := range strings.Split(c.Query("groupBy"), ",") {
+        if col = strings.TrimSpace(col); col == "" || col == "nullomers_created" {
+            continue
+        }
+        if types[col] == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown groupBy column '%s'", col)})
+            return
+        }
+        spec.GroupBy = append(spec.GroupBy, col)
+    }
+    headers, data, _, ok := runStats(c, dataset, k, source, spec)
+    if !ok {
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "headers": headers,
+        "data":    data,
+    })
+}
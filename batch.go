@@ -0,0 +1,242 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+
+    "github.com/gin-gonic/gin"
+)
+
+const maxBatchSequences = 10000
+
+// neomerAnalysis mirrors the "analysis" object of /analyze_neomer.
+type neomerAnalysis struct {
+    TotalNeomers        int64                 `json:"totalNeomers"`
+    DistinctDonors      int                   `json:"distinctDonors"`
+    DistinctCancerTypes int                   `json:"distinctCancerTypes"`
+    DistinctOrgans      int                   `json:"distinctOrgans"`
+    CancerBreakdown     []cancerTypeBreakdown `json:"cancerBreakdown"`
+    DistinctDonorIDs    []string              `json:"distinctDonorIDs"`
+    donorSet            map[string]bool
+    cancerMap           map[string]*cancerTypeBreakdown
+}
+
+type organBreakdown struct {
+    Organ string `json:"organ"`
+    Count int64  `json:"count"`
+}
+
+type cancerTypeBreakdown struct {
+    CancerType string           `json:"cancerType"`
+    Count      int64            `json:"count"`
+    Organs     []organBreakdown `json:"organs"`
+}
+
+// ------------------------------------------------------------------
+// analyzeNeomersBatchHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: POST /analyze_neomers_batch
+//           {"neomers": ["ACGT...", ...], "datasets": ["genome", "exome"]}
+//
+// Batch version of /analyze_neomer and /exome_analyze_neomer. Sequences
+// of mixed lengths are grouped by K and each neomers_K / exome_neomers_K
+// table is queried once for the whole group. Every neomer gets one
+// analysis per dataset; it is null when the dataset has no table for
+// its length.
+//
+func analyzeNeomersBatchHandler(c *gin.Context) {
+    var req struct {
+        Neomers  []string `json:"neomers"`
+        Datasets []string `json:"datasets"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body: " + err.Error()})
+        return
+    }
+    if len(req.Neomers) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing neomers"})
+        return
+    }
+    if len(req.Neomers) > maxBatchSequences {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d neomers per request", maxBatchSequences)})
+        return
+    }
+    if len(req.Datasets) == 0 {
+        req.Datasets = []string{"genome", "exome"}
+    }
+    for _, dataset := range req.Datasets {
+        if dataset != "genome" && dataset != "exome" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown dataset '%s', expected 'genome' or 'exome'", dataset)})
+            return
+        }
+    }
+
+    // Deduplicate and group by K
+    byK := map[int][]string{}
+    var neomers []string
+    seen := map[string]bool{}
+    for _, raw := range req.Neomers {
+        seq, err := normalizeSequence(raw)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if seen[seq] {
+            continue
+        }
+        seen[seq] = true
+        neomers = append(neomers, seq)
+        byK[len(seq)] = append(byK[len(seq)], seq)
+    }
+
+    analyses := map[string]map[string]*neomerAnalysis{}
+    for _, dataset := range req.Datasets {
+        prefix, _ := neomerTablePrefix(dataset)
+        ks, err := availableKs(prefix)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        available := map[int]bool{}
+        for _, k := range ks {
+            available[k] = true
+        }
+
+        results := map[string]*neomerAnalysis{}
+        analyses[dataset] = results
+        for k, group := range byK {
+            if !available[k] {
+                continue
+            }
+            for _, seq := range group {
+                results[seq] = &neomerAnalysis{
+                    CancerBreakdown:  []cancerTypeBreakdown{},
+                    DistinctDonorIDs: []string{},
+                    donorSet:         map[string]bool{},
+                    cancerMap:        map[string]*cancerTypeBreakdown{},
+                }
+            }
+            if err := batchAnalyzeTable(dataset, k, group, results); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error analysing %s%d: %v", prefix, k, err)})
+                return
+            }
+        }
+    }
+
+    type batchResult struct {
+        Neomer string                     `json:"neomer"`
+        K      int                        `json:"K"`
+        Found  bool                       `json:"found"`
+        Result map[string]*neomerAnalysis `json:"analysis"`
+    }
+    out := make([]batchResult, 0, len(neomers))
+    for _, seq := range neomers {
+        r := batchResult{Neomer: seq, K: len(seq), Result: map[string]*neomerAnalysis{}}
+        for _, dataset := range req.Datasets {
+            a := analyses[dataset][seq]
+            r.Result[dataset] = a
+            r.Found = r.Found || (a != nil && a.TotalNeomers > 0)
+        }
+        out = append(out, r)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "requested": len(req.Neomers),
+        "distinct":  len(neomers),
+        "results":   out,
+    })
+}
+
+// batchAnalyzeTable runs one query over the K table of the dataset for
+// all neomers of the group and fills their analyses.
+func batchAnalyzeTable(dataset string, k int, group []string, results map[string]*neomerAnalysis) error {
+    source, err := neomerSourceSQL(dataset, k)
+    if err != nil {
+        return err
+    }
+    // The distinct counts are taken on the raw columns, so unclassified
+    // rows show up as 'Unknown' in the breakdown without being counted
+    query := fmt.Sprintf(`
+        WITH src AS (%s),
+        hits AS (
+            SELECT * FROM src WHERE nullomers_created IN (%s)
+        ),
+        distinct_counts AS (
+            SELECT
+                nullomers_created,
+                COUNT(DISTINCT Cancer_Type) AS cancer_types,
+                COUNT(DISTINCT Organ)       AS organs
+            FROM hits
+            GROUP BY nullomers_created
+        )
+        SELECT
+            h.nullomers_created,
+            COALESCE(h.Cancer_Type, 'Unknown') AS cancer_type,
+            COALESCE(h.Organ, 'Unknown')       AS organ,
+            COUNT(*)                            AS count,
+            list(DISTINCT h.Actual_Donor_ID)    AS donors,
+            ANY_VALUE(d.cancer_types)           AS cancer_types,
+            ANY_VALUE(d.organs)                 AS organs
+        FROM hits h
+        JOIN distinct_counts d USING (nullomers_created)
+        GROUP BY h.nullomers_created, cancer_type, organ
+    `, source, sqlPlaceholders(len(group)))
+    args := make([]interface{}, len(group))
+    for i, seq := range group {
+        args[i] = seq
+    }
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var seq, cancerType, organ string
+        var count, cancerTypes, organs int64
+        var donors interface{}
+        if err := rows.Scan(&seq, &cancerType, &organ, &count, &donors, &cancerTypes, &organs); err != nil {
+            return err
+        }
+        a := results[seq]
+        if a == nil {
+            continue
+        }
+        a.TotalNeomers += count
+        a.DistinctCancerTypes = int(cancerTypes)
+        a.DistinctOrgans = int(organs)
+        if list, ok := donors.([]interface{}); ok {
+            for _, d := range list {
+                if id, ok := d.(string); ok && !a.donorSet[id] {
+                    a.donorSet[id] = true
+                    a.DistinctDonorIDs = append(a.DistinctDonorIDs, id)
+                }
+            }
+        }
+        ct, ok := a.cancerMap[cancerType]
+        if !ok {
+            ct = &cancerTypeBreakdown{CancerType: cancerType}
+            a.cancerMap[cancerType] = ct
+        }
+        ct.Count += count
+        ct.Organs = append(ct.Organs, organBreakdown{Organ: organ, Count: count})
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    for _, seq := range group {
+        a := results[seq]
+        a.DistinctDonors = len(a.donorSet)
+        sort.Strings(a.DistinctDonorIDs)
+        for _, ct := range a.cancerMap {
+            a.CancerBreakdown = append(a.CancerBreakdown, *ct)
+        }
+        sort.Slice(a.CancerBreakdown, func(i, j int) bool {
+            return a.CancerBreakdown[i].Count > a.CancerBreakdown[j].Count
+        })
+    }
+    return nil
+}
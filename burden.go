@@ -0,0 +1,583 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Per-donor neomer burden
+// ------------------------------------------------------------------
+//
+// The build-donor-counts subcommand precomputes donor_neomer_counts with
+// one row per dataset, K and donor: the donor's number of distinct
+// neomers at K over all its samples (0 when it has none) with its
+// cancer type and organ.
+// Every donor of the dataset's mapping table gets a row at every K, so
+// percentiles account for donors without neomers.
+
+const donorCountsTable = "donor_neomer_counts"
+
+func buildDonorCountsCommand(args []string) error {
+    fs := flag.NewFlagSet("build-donor-counts", flag.ContinueOnError)
+    dataset := fs.String("dataset", "", "genome or exome (both when empty)")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    datasets := []string{"genome", "exome"}
+    if *dataset != "" {
+        if _, err := neomerTablePrefix(*dataset); err != nil {
+            return err
+        }
+        datasets = []string{*dataset}
+    }
+    if err := initializeDatabase(); err != nil {
+        return err
+    }
+    defer db.Close()
+
+    if _, err := db.Exec(fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %s (
+            dataset          VARCHAR,
+            K                INTEGER,
+            Actual_Donor_ID  VARCHAR,
+            Cancer_Type      VARCHAR,
+            Organ            VARCHAR,
+            distinct_neomers BIGINT
+        )
+    `, donorCountsTable)); err != nil {
+        return err
+    }
+
+    for _, d := range datasets {
+        prefix, _ := neomerTablePrefix(d)
+        ks, err := availableKs(prefix)
+        if err != nil {
+            return err
+        }
+        if len(ks) == 0 {
+            log.Printf("Skipping %s: no %s tables", d, prefix+"K")
+            continue
+        }
+
+        // A donor's count covers the neomers of all its samples (mapping
+        // rows). The genome dataset classifies donors through the
+        // Project_Code of their neomer rows, the exome dataset in
+        // exome_donor_data
+        tables, _ := datasetDonorTables(d)
+        projectCol, donorsSQL := "Project_Code", `
+            SELECT m.Actual_Donor_ID, ANY_VALUE(c.Cancer_Type) AS Cancer_Type, ANY_VALUE(c.Organ) AS Organ
+            FROM mapping m
+            LEFT JOIN (SELECT Actual_Donor_ID, ANY_VALUE(pc) AS pc FROM counts GROUP BY Actual_Donor_ID) p
+                   ON p.Actual_Donor_ID = m.Actual_Donor_ID
+            LEFT JOIN cancer_type_details c ON c.Project_Code = p.pc
+            GROUP BY m.Actual_Donor_ID
+        `
+        if d == "exome" {
+            projectCol, donorsSQL = "NULL", `
+                SELECT m.Actual_Donor_ID, ANY_VALUE(e.Cancer_Type) AS Cancer_Type, ANY_VALUE(e.Organ) AS Organ
+                FROM mapping m
+                LEFT JOIN exome_donor_data e ON e.bcr_patient_barcode = m.Actual_Donor_ID
+                GROUP BY m.Actual_Donor_ID
+            `
+        }
+        var parts, kValues []string
+        for _, k := range ks {
+            parts = append(parts, fmt.Sprintf(`
+                SELECT %[1]d AS K, CAST("Donor_ID" AS INT) AS did, nullomers_created, %[2]s AS pc
+                FROM %[3]s%[1]d`, k, projectCol, prefix))
+            kValues = append(kValues, fmt.Sprintf("(%d)", k))
+        }
+        insert := fmt.Sprintf(`
+            INSERT INTO %s
+            WITH mapping AS (
+                SELECT DISTINCT Donor_ID, Actual_Donor_ID FROM %s WHERE Actual_Donor_ID IS NOT NULL
+            ),
+            counts AS (
+                SELECT h.K, m.Actual_Donor_ID, COUNT(DISTINCT h.nullomers_created) AS n, ANY_VALUE(h.pc) AS pc
+                FROM (%s) h
+                JOIN mapping m ON m.Donor_ID = h.did
+                GROUP BY h.K, m.Actual_Donor_ID
+            ),
+            donors AS (%s)
+            SELECT ?, k.K, d.Actual_Donor_ID,
+                   COALESCE(d.Cancer_Type, 'Unknown'), COALESCE(d.Organ, 'Unknown'),
+                   COALESCE(cn.n, 0)
+            FROM donors d
+            CROSS JOIN (VALUES %s) k(K)
+            LEFT JOIN counts cn ON cn.Actual_Donor_ID = d.Actual_Donor_ID AND cn.K = k.K
+        `, donorCountsTable, tables.Mapping, strings.Join(parts, " UNION ALL "), donorsSQL, strings.Join(kValues, ", "))
+
+        tx, err := db.Begin()
+        if err != nil {
+            return err
+        }
+        if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE dataset = ?", donorCountsTable), d); err != nil {
+            tx.Rollback()
+            return err
+        }
+        if _, err := tx.Exec(insert, d); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("counting %s donors: %w", d, err)
+        }
+        if err := tx.Commit(); err != nil {
+            return err
+        }
+
+        var rows int64
+        if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE dataset = ?", donorCountsTable), d).Scan(&rows); err != nil {
+            return fmt.Errorf("counting %s rows: %w", donorCountsTable, err)
+        }
+        log.Printf("%s: %d donor/K rows for K %v", d, rows, ks)
+    }
+    return nil
+}
+
+// ------------------------------------------------------------------
+// getPatientBurdenHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /patient_burden?donor_id=DO1234[&dataset=genome|exome]
+//
+// The donor's distinct neomer count at every K and its percentile among
+// the donors of its cancer type, its organ and the whole cohort of the
+// dataset. Percentiles use mid-ranks: 100 * (below + equal / 2) / n,
+// with the donor itself among the equal ones. Without "dataset" every
+// dataset the donor appears in is reported. Requires build-donor-counts.
+//
+func getPatientBurdenHandler(c *gin.Context) {
+    donorID := c.Query("donor_id")
+    if donorID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing donor_id"})
+        return
+    }
+    cols, err := tableColumns(donorCountsTable)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(cols) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No %s table; run the build-donor-counts subcommand first", donorCountsTable)})
+        return
+    }
+
+    where := "me.Actual_Donor_ID = ?"
+    args := []interface{}{donorID}
+    if d := c.Query("dataset"); d != "" {
+        if d != "genome" && d != "exome" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown dataset '%s', expected 'genome' or 'exome'", d)})
+            return
+        }
+        where += " AND me.dataset = ?"
+        args = append(args, d)
+    }
+
+    query := fmt.Sprintf(`
+        SELECT
+            me.dataset, me.K, me.distinct_neomers, me.Cancer_Type, me.Organ,
+            COUNT(*) FILTER (WHERE t.Cancer_Type = me.Cancer_Type),
+            COUNT(*) FILTER (WHERE t.Cancer_Type = me.Cancer_Type AND t.distinct_neomers < me.distinct_neomers),
+            COUNT(*) FILTER (WHERE t.Cancer_Type = me.Cancer_Type AND t.distinct_neomers = me.distinct_neomers),
+            MEDIAN(t.distinct_neomers) FILTER (WHERE t.Cancer_Type = me.Cancer_Type),
+            COUNT(*) FILTER (WHERE t.Organ = me.Organ),
+            COUNT(*) FILTER (WHERE t.Organ = me.Organ AND t.distinct_neomers < me.distinct_neomers),
+            COUNT(*) FILTER (WHERE t.Organ = me.Organ AND t.distinct_neomers = me.distinct_neomers),
+            MEDIAN(t.distinct_neomers) FILTER (WHERE t.Organ = me.Organ),
+            COUNT(*),
+            COUNT(*) FILTER (WHERE t.distinct_neomers < me.distinct_neomers),
+            COUNT(*) FILTER (WHERE t.distinct_neomers = me.distinct_neomers),
+            MEDIAN(t.distinct_neomers)
+        FROM %[1]s me
+        JOIN %[1]s t ON t.dataset = me.dataset AND t.K = me.K
+        WHERE %[2]s
+        GROUP BY ALL
+        ORDER BY me.dataset, me.K
+    `, donorCountsTable, where)
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    type groupRank struct {
+        Group      string  `json:"group"`
+        Donors     int64   `json:"donors"`
+        Median     float64 `json:"median"`
+        Percentile float64 `json:"percentile"`
+    }
+    type burden struct {
+        Dataset         string    `json:"dataset"`
+        K               int       `json:"K"`
+        DistinctNeomers int64     `json:"distinctNeomers"`
+        CancerType      groupRank `json:"cancerType"`
+        Organ           groupRank `json:"organ"`
+        Cohort          groupRank `json:"cohort"`
+    }
+    rank := func(g *groupRank, below, equal int64) {
+        if g.Donors > 0 {
+            g.Percentile = 100 * (float64(below) + float64(equal)/2) / float64(g.Donors)
+        }
+    }
+    result := []burden{}
+    for rows.Next() {
+        var b burden
+        var ctBelow, ctEqual, orgBelow, orgEqual, allBelow, allEqual int64
+        if err := rows.Scan(
+            &b.Dataset, &b.K, &b.DistinctNeomers, &b.CancerType.Group, &b.Organ.Group,
+            &b.CancerType.Donors, &ctBelow, &ctEqual, &b.CancerType.Median,
+            &b.Organ.Donors, &orgBelow, &orgEqual, &b.Organ.Median,
+            &b.Cohort.Donors, &allBelow, &allEqual, &b.Cohort.Median,
+        ); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        b.Cohort.Group = "all donors"
+        rank(&b.CancerType, ctBelow, ctEqual)
+        rank(&b.Organ, orgBelow, orgEqual)
+        rank(&b.Cohort, allBelow, allEqual)
+        result = append(result, b)
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(result) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Donor '%s' not found in %s", donorID, donorCountsTable)})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "donorId": donorID,
+        "burden":  result,
+    })
+}
+
+// burdenAssociationDefaults are the clinical variables tested by
+// /burden_association when none are requested, where present.
+var burdenAssociationDefaults = []string{
+    "donor_age_at_diagnosis", "donor_sex", "donor_tumour_stage_at_diagnosis", "tumour_grade",
+    "age_at_initial_pathologic_diagnosis", "gender", "ajcc_pathologic_tumor_stage", "histological_grade",
+}
+
+// burdenStrata maps the "stratify" values of /burden_association to
+// the group expression of each donor.
+var burdenStrata = map[string]string{
+    "none":        "'all'",
+    "cancer_type": "COALESCE(Cancer_Type, 'Unknown')",
+    "organ":       "COALESCE(Organ, 'Unknown')",
+}
+
+// donorBurdenSQL returns the donor view of the dataset with a "burden"
+// column, the donor's number of distinct neomers at K (0 without
+// neomers), and whether it comes from donor_neomer_counts ("precomputed")
+// or the neomer table ("live").
+func donorBurdenSQL(dataset string, k int) (string, string, error) {
+    view, err := donorViewSQL(dataset)
+    if err != nil {
+        return "", "", err
+    }
+    cols, err := tableColumns(donorCountsTable)
+    if err != nil {
+        return "", "", err
+    }
+    if len(cols) > 0 {
+        var n int64
+        if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE dataset = ? AND K = ?", donorCountsTable), dataset, k).Scan(&n); err != nil {
+            return "", "", err
+        }
+        if n > 0 {
+            // Aggregated per donor, so tables built before counts covered
+            // all of a donor's samples still give one row per donor
+            return fmt.Sprintf(`
+                SELECT v.*, COALESCE(b.n, 0) AS burden
+                FROM (%s) v
+                LEFT JOIN (
+                    SELECT Actual_Donor_ID, MAX(distinct_neomers) AS n
+                    FROM %s
+                    WHERE dataset = %s AND K = %d
+                    GROUP BY Actual_Donor_ID
+                ) b ON b.Actual_Donor_ID = v.Actual_Donor_ID
+            `, view, donorCountsTable, sqlStringLiteral(dataset), k), "precomputed", nil
+        }
+    }
+
+    prefix, _ := neomerTablePrefix(dataset)
+    table := fmt.Sprintf("%s%d", prefix, k)
+    if cols, err := tableColumns(table); err != nil {
+        return "", "", err
+    } else if len(cols) == 0 {
+        return "", "", fmt.Errorf("no %s table", table)
+    }
+    tables, _ := datasetDonorTables(dataset)
+    return fmt.Sprintf(`
+        SELECT v.*, COALESCE(b.n, 0) AS burden
+        FROM (%s) v
+        LEFT JOIN (
+            SELECT m.Actual_Donor_ID, COUNT(DISTINCT n.nullomers_created) AS n
+            FROM %s n
+            JOIN %s m ON CAST(n."Donor_ID" AS INT) = m.Donor_ID
+            GROUP BY m.Actual_Donor_ID
+        ) b ON b.Actual_Donor_ID = v.Actual_Donor_ID
+    `, view, table, tables.Mapping), "live", nil
+}
+
+// numericValue converts a scanned numeric column value to float64.
+func numericValue(v interface{}) (float64, bool) {
+    switch x := v.(type) {
+    case float64:
+        return x, true
+    case float32:
+        return float64(x), true
+    case int64:
+        return float64(x), true
+    case int32:
+        return float64(x), true
+    case int16:
+        return float64(x), true
+    case int8:
+        return float64(x), true
+    case uint64:
+        return float64(x), true
+    case uint32:
+        return float64(x), true
+    }
+    f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+    return f, err == nil
+}
+
+type burdenLevel struct {
+    Value        string  `json:"value"`
+    Donors       int     `json:"donors"`
+    MedianBurden float64 `json:"medianBurden"`
+}
+
+type burdenAssociation struct {
+    Group         string        `json:"group"`
+    Variable      string        `json:"variable"`
+    Test          string        `json:"test"`
+    Donors        int           `json:"donors"`
+    Statistic     float64       `json:"statistic"`
+    EffectSize    float64       `json:"effectSize"`
+    EffectMeasure string        `json:"effectMeasure"`
+    PValue        float64       `json:"pValue"`
+    QValue        float64       `json:"qValue"`
+    Levels        []burdenLevel `json:"levels,omitempty"`
+}
+
+// testBurdenAssociation tests one variable against burden among the
+// donors of one group: Spearman for numeric variables, Mann-Whitney for
+// two levels and Kruskal-Wallis for more. Levels with fewer than
+// minDonors donors are left out. It returns a reason instead when the
+// test cannot be run.
+func testBurdenAssociation(variable string, numeric bool, values []interface{}, burden []float64, minDonors int) (burdenAssociation, string) {
+    a := burdenAssociation{Variable: variable}
+    if numeric {
+        var x, y []float64
+        for i, v := range values {
+            if f, ok := numericValue(v); ok && v != nil {
+                x, y = append(x, f), append(y, burden[i])
+            }
+        }
+        if len(x) < minDonors || len(x) < 3 {
+            return a, fmt.Sprintf("%d donors with a value, need %d", len(x), minDonors)
+        }
+        rho, p := spearmanTest(x, y)
+        if math.IsNaN(rho) {
+            return a, "constant variable or burden"
+        }
+        a.Test, a.Donors = "spearman", len(x)
+        a.Statistic, a.EffectSize, a.EffectMeasure, a.PValue = rho, rho, "rho", p
+        return a, ""
+    }
+
+    byLevel := map[string][]float64{}
+    for i, v := range values {
+        if v != nil {
+            key := fmt.Sprint(v)
+            byLevel[key] = append(byLevel[key], burden[i])
+        }
+    }
+    var names []string
+    for name, b := range byLevel {
+        if len(b) >= minDonors {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+    if len(names) < 2 {
+        return a, fmt.Sprintf("%d levels with at least %d donors, need 2", len(names), minDonors)
+    }
+    groups := make([][]float64, len(names))
+    for i, name := range names {
+        groups[i] = byLevel[name]
+        sorted := append([]float64{}, groups[i]...)
+        sort.Float64s(sorted)
+        a.Levels = append(a.Levels, burdenLevel{name, len(sorted), percentile(sorted, 0.5)})
+        a.Donors += len(sorted)
+    }
+    if len(groups) == 2 {
+        u, r, p := mannWhitneyTest(groups[0], groups[1])
+        a.Test, a.Statistic, a.EffectSize, a.EffectMeasure, a.PValue = "mann_whitney", u, r, "rank_biserial", p
+    } else {
+        h, eps, p := kruskalWallisTest(groups)
+        a.Test, a.Statistic, a.EffectSize, a.EffectMeasure, a.PValue = "kruskal_wallis", h, eps, "epsilon_squared", p
+    }
+    if math.IsNaN(a.PValue) {
+        return a, "not enough donors"
+    }
+    return a, ""
+}
+
+// ------------------------------------------------------------------
+// getBurdenAssociationHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /burden_association?dataset=genome&K=16
+//                               &variables=donor_age_at_diagnosis,donor_sex
+//                               &stratify=cancer_type&minDonors=5
+//                               [&filters=...&column=...&filterType=between&value=...&cohort=...]
+//
+// Tests whether each clinical variable is associated with the donors'
+// neomer burden (distinct neomers at K, 0 for donors without neomers).
+// Numeric variables (including text columns holding only numbers) use
+// Spearman's rho; categorical ones Mann-Whitney (two levels,
+// rank-biserial effect, positive when the first level by name has the
+// higher burden) or Kruskal-Wallis (epsilon-squared).
+// stratify=cancer_type or organ runs the tests within every group,
+// none (default) across all donors matching the filters, which take
+// the grammar and columns of /donors. p-values are two-sided; qValue
+// is the Benjamini-Hochberg adjustment over all returned tests. Tests
+// that cannot be run are listed under "skipped" with the reason.
+// Burden comes from donor_neomer_counts when it is built for K.
+//
+func getBurdenAssociationHandler(c *gin.Context) {
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    stratify := c.DefaultQuery("stratify", "none")
+    groupExpr, ok := burdenStrata[stratify]
+    if !ok {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'stratify' must be 'none', 'cancer_type' or 'organ'"})
+        return
+    }
+    minDonors := 5
+    if m, err := strconv.Atoi(c.Query("minDonors")); err == nil && m > 0 {
+        minDonors = m
+    }
+    source, mode, err := donorBurdenSQL(dataset, k)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    q, ok := parseDonorRowsQuery(c, source, dataset)
+    if !ok {
+        return
+    }
+
+    var variables []string
+    if c.Query("variables") == "" {
+        for _, col := range burdenAssociationDefaults {
+            if q.Types[col] != "" {
+                variables = append(variables, col)
+            }
+        }
+    }
+    for _, col := range strings.Split(c.Query("variables"), ",") {
+        if col = strings.TrimSpace(col); col == "" {
+            continue
+        }
+        if q.Types[col] == "" || col == "burden" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown variable '%s'", col)})
+            return
+        }
+        variables = append(variables, col)
+    }
+    if len(variables) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "No clinical variables to test"})
+        return
+    }
+
+    numeric, err := numericColumns(source, q.Types, variables)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    selects := []string{groupExpr + " AS grp", "CAST(burden AS DOUBLE)"}
+    for _, col := range variables {
+        selects = append(selects, fmt.Sprintf(`"%s"`, col))
+    }
+    _, rows, err := queryTable(fmt.Sprintf("SELECT %s FROM (%s) %s", strings.Join(selects, ", "), q.Source, q.Where), q.Args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    // Burden and variable values per group
+    type groupData struct {
+        burden []float64
+        values [][]interface{}
+    }
+    groups := map[string]*groupData{}
+    for _, row := range rows {
+        name := fmt.Sprint(row[0])
+        g, ok := groups[name]
+        if !ok {
+            g = &groupData{values: make([][]interface{}, len(variables))}
+            groups[name] = g
+        }
+        b, _ := numericValue(row[1])
+        g.burden = append(g.burden, b)
+        for i := range variables {
+            g.values[i] = append(g.values[i], row[2+i])
+        }
+    }
+    names := make([]string, 0, len(groups))
+    for name := range groups {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    results := []burdenAssociation{}
+    skipped := []gin.H{}
+    for _, name := range names {
+        g := groups[name]
+        for i, col := range variables {
+            a, reason := testBurdenAssociation(col, numeric[col], g.values[i], g.burden, minDonors)
+            if reason != "" {
+                skipped = append(skipped, gin.H{"group": name, "variable": col, "reason": reason})
+                continue
+            }
+            a.Group = name
+            results = append(results, a)
+        }
+    }
+    pvalues := make([]float64, len(results))
+    for i, a := range results {
+        pvalues[i] = a.PValue
+    }
+    for i, q := range benjaminiHochberg(pvalues) {
+        results[i].QValue = q
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":        k,
+        "dataset":  dataset,
+        "mode":     mode,
+        "stratify": stratify,
+        "donors":   len(rows),
+        "results":  results,
+        "skipped":  skipped,
+    })
+}
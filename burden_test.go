@@ -0,0 +1,122 @@
+package main
+
+import (
+    "database/sql"
+    "fmt"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestBurdenAssociationTestSelection(t *testing.T) {
+    burden := []float64{3, 5, 8, 2, 9, 4, 7, 1, 6, 10}
+    levels := func(names ...string) []interface{} {
+        values := make([]interface{}, len(names))
+        for i, n := range names {
+            values[i] = n
+        }
+        return values
+    }
+
+    cases := []struct {
+        name    string
+        numeric bool
+        values  []interface{}
+        test    string
+        donors  int
+        levels  int
+    }{
+        {"numeric", true, []interface{}{int64(30), int64(41), 52.5, int64(38), int64(60), int64(45), int64(33), int64(70), int64(49), int64(58)}, "spearman", 10, 0},
+        {"numeric text", true, levels("30", "41", "52", "38", "60", "45", "33", "70", "49", "58"), "spearman", 10, 0},
+        {"nulls left out", true, []interface{}{int64(30), nil, int64(52), int64(38), nil, int64(45), int64(33), int64(70), int64(49), int64(58)}, "spearman", 8, 0},
+        {"two levels", false, levels("male", "female", "male", "female", "male", "female", "male", "female", "male", "female"), "mann_whitney", 10, 2},
+        {"three levels", false, levels("I", "II", "III", "I", "II", "III", "I", "II", "III", "I"), "kruskal_wallis", 10, 3},
+        {"small level left out", false, levels("G1", "G1", "G1", "G2", "G2", "G2", "G3", "G1", "G2", "G2"), "mann_whitney", 9, 2},
+    }
+    for _, tc := range cases {
+        a, reason := testBurdenAssociation("v", tc.numeric, tc.values, burden, 3)
+        if reason != "" {
+            t.Errorf("%s: skipped: %s", tc.name, reason)
+            continue
+        }
+        if a.Test != tc.test || a.Donors != tc.donors || len(a.Levels) != tc.levels {
+            t.Errorf("%s: got %s on %d donors with %d levels, want %s on %d with %d",
+                tc.name, a.Test, a.Donors, len(a.Levels), tc.test, tc.donors, tc.levels)
+        }
+        if a.PValue < 0 || a.PValue > 1 {
+            t.Errorf("%s: p-value %v out of range", tc.name, a.PValue)
+        }
+    }
+
+    // Mann-Whitney levels are ordered by name; the effect is positive
+    // when the first level has the higher burden
+    a, _ := testBurdenAssociation("v", false, levels("a", "a", "a", "b", "b", "b"), []float64{7, 8, 9, 1, 2, 3}, 3)
+    if a.Levels[0].Value != "a" || a.EffectSize != 1 || a.Levels[0].MedianBurden != 8 {
+        t.Errorf("got levels %+v and effect %v, want a first with median 8 and effect 1", a.Levels, a.EffectSize)
+    }
+
+    skips := []struct {
+        name    string
+        numeric bool
+        values  []interface{}
+    }{
+        {"one level", false, levels("x", "x", "x", "x", "x", "x", "x", "x", "x", "y")},
+        {"too few donors", true, []interface{}{int64(1), int64(2), nil, nil, nil, nil, nil, nil, nil, nil}},
+        {"constant variable", true, []interface{}{int64(5), int64(5), int64(5), int64(5), int64(5), int64(5), int64(5), int64(5), int64(5), int64(5)}},
+    }
+    for _, tc := range skips {
+        if _, reason := testBurdenAssociation("v", tc.numeric, tc.values, burden, 3); reason == "" {
+            t.Errorf("%s: test was run, want skipped", tc.name)
+        }
+    }
+}
+
+func TestBuildDonorCountsSamplesPerDonor(t *testing.T) {
+    // DO1 has two samples (internal IDs 1 and 2) sharing one neomer
+    path := filepath.Join(t.TempDir(), "neomers.ddb")
+    fixture, err := sql.Open("duckdb", path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, stmt := range []string{
+        `CREATE TABLE donor_id_mapping (Donor_ID INTEGER, Actual_Donor_ID VARCHAR, Tumor_Sample_Barcode VARCHAR)`,
+        `INSERT INTO donor_id_mapping VALUES (1, 'DO1', 'S1'), (2, 'DO1', 'S2'), (3, 'DO2', 'S3'), (4, 'DO3', 'S4')`,
+        `CREATE TABLE cancer_type_details (Project_Code VARCHAR, Cancer_Type VARCHAR, Organ VARCHAR)`,
+        `INSERT INTO cancer_type_details VALUES ('LIHC-US', 'LIHC', 'Liver')`,
+        `CREATE TABLE neomers_11 (nullomers_created VARCHAR, Donor_ID VARCHAR, Project_Code VARCHAR)`,
+        `INSERT INTO neomers_11 VALUES ('AAAAAAAAAAA', '1', 'LIHC-US'), ('CCCCCCCCCCC', '1', 'LIHC-US'),
+            ('CCCCCCCCCCC', '2', 'LIHC-US'), ('GGGGGGGGGGG', '2', 'LIHC-US'), ('AAAAAAAAAAA', '3', 'LIHC-US')`,
+    } {
+        if _, err := fixture.Exec(stmt); err != nil {
+            t.Fatalf("%s: %v", stmt, err)
+        }
+    }
+    fixture.Close()
+
+    t.Setenv("NEOMERS_DUCK_DB_FILE", path)
+    previous := db
+    defer func() { db = previous }()
+    if err := buildDonorCountsCommand([]string{"-dataset", "genome"}); err != nil {
+        t.Fatal(err)
+    }
+
+    useTestDB(t, fmt.Sprintf("ATTACH %s AS built (READ_ONLY)", sqlStringLiteral(path)))
+    rows, err := db.Query(`SELECT Actual_Donor_ID, Cancer_Type, distinct_neomers FROM built.donor_neomer_counts ORDER BY Actual_Donor_ID`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer rows.Close()
+    var got []string
+    for rows.Next() {
+        var donor, cancerType string
+        var n int64
+        if err := rows.Scan(&donor, &cancerType, &n); err != nil {
+            t.Fatal(err)
+        }
+        got = append(got, fmt.Sprintf("%s %s %d", donor, cancerType, n))
+    }
+    want := []string{"DO1 LIHC 3", "DO2 LIHC 1", "DO3 Unknown 0"}
+    if strings.Join(got, ", ") != strings.Join(want, ", ") {
+        t.Errorf("got %v, want %v", got, want)
+    }
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "log"
+    "math"
+    "math/rand"
+    "net/http"
+    "os"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Cancer-type classifier
+// ------------------------------------------------------------------
+//
+// A Bernoulli naive Bayes model on binary neomer presence. Features are
+// the neomers of one neomers_K / exome_neomers_K table carried by at
+// least -minDonors training donors; labels are the donors' Cancer_Type
+// or Organ. Cross-validation selects features within each training
+// fold, so test donors never influence them.
+// The model is trained offline with the train-classifier subcommand,
+// which reports k-fold cross-validated accuracy and writes the model
+// as JSON. The server loads it from NEOMERS_CLASSIFIER_MODEL and scores
+// submitted neomer lists on POST /classify.
+
+type classifierModel struct {
+    K           int              `json:"K"`
+    Dataset     string           `json:"dataset"`
+    Label       string           `json:"label"`
+    Alpha       float64          `json:"alpha"`
+    Classes     []string         `json:"classes"`
+    ClassDonors []int            `json:"classDonors"`
+    Features    map[string][]int `json:"features"` // neomer -> carriers per class
+    CVAccuracy  float64          `json:"cvAccuracy"`
+    CVFolds     []float64        `json:"cvFoldAccuracies"`
+    TrainedAt   time.Time        `json:"trainedAt"`
+
+    // derived on load
+    logPrior  []float64
+    logAbsent []float64            // sum over all features of log(1 - p_fc)
+    logOdds   map[string][]float64 // log(p_fc) - log(1 - p_fc)
+}
+
+var (
+    classifierMu  sync.RWMutex
+    classifier    *classifierModel
+    classifierErr error
+)
+
+func getClassifierModelPath() string {
+    return os.Getenv("NEOMERS_CLASSIFIER_MODEL")
+}
+
+// prepare derives the per-class log probabilities from the counts.
+func (m *classifierModel) prepare() {
+    total := 0
+    for _, n := range m.ClassDonors {
+        total += n
+    }
+    nc := len(m.Classes)
+    m.logPrior = make([]float64, nc)
+    m.logAbsent = make([]float64, nc)
+    m.logOdds = make(map[string][]float64, len(m.Features))
+    for ci, n := range m.ClassDonors {
+        m.logPrior[ci] = math.Log((float64(n) + m.Alpha) / (float64(total) + m.Alpha*float64(nc)))
+    }
+    for neomer, counts := range m.Features {
+        odds := make([]float64, nc)
+        for ci := range m.Classes {
+            p := (float64(counts[ci]) + m.Alpha) / (float64(m.ClassDonors[ci]) + 2*m.Alpha)
+            m.logAbsent[ci] += math.Log(1 - p)
+            odds[ci] = math.Log(p) - math.Log(1-p)
+        }
+        m.logOdds[neomer] = odds
+    }
+}
+
+// score returns the posterior class probabilities of a neomer set.
+func (m *classifierModel) score(neomers []string) []float64 {
+    nc := len(m.Classes)
+    logp := make([]float64, nc)
+    for ci := range logp {
+        logp[ci] = m.logPrior[ci] + m.logAbsent[ci]
+    }
+    for _, neomer := range neomers {
+        if odds, ok := m.logOdds[neomer]; ok {
+            for ci := range logp {
+                logp[ci] += odds[ci]
+            }
+        }
+    }
+    max := math.Inf(-1)
+    for _, v := range logp {
+        max = math.Max(max, v)
+    }
+    sum := 0.0
+    probs := make([]float64, nc)
+    for ci, v := range logp {
+        probs[ci] = math.Exp(v - max)
+        sum += probs[ci]
+    }
+    for ci := range probs {
+        probs[ci] /= sum
+    }
+    return probs
+}
+
+func loadClassifier(path string) {
+    m, err := readClassifierModel(path)
+
+    classifierMu.Lock()
+    defer classifierMu.Unlock()
+    if err != nil {
+        classifierErr = err
+        log.Printf("Classifier unavailable: %v", err)
+        return
+    }
+    classifier = m
+    log.Printf("Classifier %s loaded: %d classes, %d features, cross-validated accuracy %.3f",
+        path, len(m.Classes), len(m.Features), m.CVAccuracy)
+}
+
+func readClassifierModel(path string) (*classifierModel, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open classifier model %s: %w", path, err)
+    }
+    defer f.Close()
+
+    var m classifierModel
+    if err := json.NewDecoder(f).Decode(&m); err != nil {
+        return nil, fmt.Errorf("failed to decode classifier model %s: %w", path, err)
+    }
+    if len(m.Classes) == 0 || len(m.ClassDonors) != len(m.Classes) {
+        return nil, fmt.Errorf("classifier model %s has no classes", path)
+    }
+    for neomer, counts := range m.Features {
+        if len(counts) != len(m.Classes) {
+            return nil, fmt.Errorf("classifier model %s: feature %s has %d class counts, expected %d", path, neomer, len(counts), len(m.Classes))
+        }
+    }
+    m.prepare()
+    return &m, nil
+}
+
+// ------------------------------------------------------------------
+// train-classifier subcommand
+// ------------------------------------------------------------------
+
+func trainClassifierCommand(args []string) error {
+    fs := flag.NewFlagSet("train-classifier", flag.ContinueOnError)
+    k := fs.Int("K", 16, "neomer length")
+    dataset := fs.String("dataset", "genome", "genome or exome")
+    label := fs.String("label", "cancer_type", "class label: cancer_type or organ")
+    minDonors := fs.Int("minDonors", 2, "minimum donors carrying a neomer for it to be a feature")
+    alpha := fs.Float64("alpha", 1, "Laplace smoothing")
+    folds := fs.Int("folds", 5, "cross-validation folds (0 to skip)")
+    seed := fs.Int64("seed", 1, "random seed for the fold assignment")
+    out := fs.String("out", "classifier.json", "output model file")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+
+    labelCol := map[string]string{"cancer_type": "Cancer_Type", "organ": "Organ"}[*label]
+    if labelCol == "" {
+        return fmt.Errorf("-label must be cancer_type or organ")
+    }
+    if !(*alpha > 0) || math.IsInf(*alpha, 1) {
+        return fmt.Errorf("-alpha must be a positive number")
+    }
+    if *minDonors < 1 {
+        return fmt.Errorf("-minDonors must be at least 1")
+    }
+    if *folds == 1 || *folds < 0 {
+        return fmt.Errorf("-folds must be 0 or at least 2")
+    }
+    source, err := neomerSourceSQL(*dataset, *k)
+    if err != nil {
+        return err
+    }
+    if err := initializeDatabase(); err != nil {
+        return err
+    }
+    defer db.Close()
+
+    // 1) Donor labels and candidate feature incidence. A neomer carried by
+    // fewer than minDonors donors overall cannot qualify in any fold.
+    log.Printf("Loading %s K=%d incidence (candidates carried by >= %d donors)", *dataset, *k, *minDonors)
+    query := fmt.Sprintf(`
+        WITH src AS (%s),
+        pairs AS (
+            SELECT DISTINCT Actual_Donor_ID, %s AS label, nullomers_created FROM src
+        ),
+        features AS (
+            SELECT nullomers_created FROM pairs
+            GROUP BY nullomers_created
+            HAVING COUNT(DISTINCT Actual_Donor_ID) >= ?
+        )
+        SELECT p.Actual_Donor_ID, p.label, f.nullomers_created
+        FROM pairs p
+        LEFT JOIN features f USING (nullomers_created)
+        WHERE p.label IS NOT NULL
+    `, source, labelCol)
+    rows, err := db.Query(query, *minDonors)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    type donor struct {
+        class    int
+        features []int
+    }
+    classIndex := map[string]int{}
+    featureIndex := map[string]int{}
+    var classes, features []string
+    donorIndex := map[string]*donor{}
+    var donors []*donor
+    for rows.Next() {
+        var id, cls string
+        var neomer *string
+        if err := rows.Scan(&id, &cls, &neomer); err != nil {
+            return err
+        }
+        ci, ok := classIndex[cls]
+        if !ok {
+            ci = len(classes)
+            classIndex[cls] = ci
+            classes = append(classes, cls)
+        }
+        d, ok := donorIndex[id]
+        if !ok {
+            d = &donor{class: ci}
+            donorIndex[id] = d
+            donors = append(donors, d)
+        }
+        if neomer == nil {
+            continue
+        }
+        fi, ok := featureIndex[*neomer]
+        if !ok {
+            fi = len(features)
+            featureIndex[*neomer] = fi
+            features = append(features, *neomer)
+        }
+        d.features = append(d.features, fi)
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+    if len(classes) < 2 {
+        return fmt.Errorf("need at least two classes, found %d", len(classes))
+    }
+    log.Printf("%d donors, %d classes, %d candidate features", len(donors), len(classes), len(features))
+    if *folds > len(donors) {
+        return fmt.Errorf("-folds %d exceeds the number of donors (%d)", *folds, len(donors))
+    }
+
+    // fit builds a model from a subset of donors, keeping the features
+    // carried by at least minDonors of them.
+    fit := func(train []*donor) *classifierModel {
+        m := &classifierModel{
+            K: *k, Dataset: *dataset, Label: *label, Alpha: *alpha,
+            Classes:     classes,
+            ClassDonors: make([]int, len(classes)),
+            Features:    map[string][]int{},
+        }
+        counts := make([][]int, len(features))
+        carriers := make([]int, len(features))
+        for _, d := range train {
+            m.ClassDonors[d.class]++
+            for _, fi := range d.features {
+                if counts[fi] == nil {
+                    counts[fi] = make([]int, len(classes))
+                }
+                counts[fi][d.class]++
+                carriers[fi]++
+            }
+        }
+        for fi, f := range features {
+            if counts[fi] != nil && carriers[fi] >= *minDonors {
+                m.Features[f] = counts[fi]
+            }
+        }
+        m.prepare()
+        return m
+    }
+    predict := func(m *classifierModel, d *donor) int {
+        neomers := make([]string, len(d.features))
+        for i, fi := range d.features {
+            neomers[i] = features[fi]
+        }
+        probs := m.score(neomers)
+        best := 0
+        for ci := range probs {
+            if probs[ci] > probs[best] {
+                best = ci
+            }
+        }
+        return best
+    }
+
+    // 2) k-fold cross-validation
+    var foldAcc []float64
+    cvAccuracy := 0.0
+    if *folds >= 2 {
+        order := rand.New(rand.NewSource(*seed)).Perm(len(donors))
+        correct := 0
+        for f := 0; f < *folds; f++ {
+            var train, test []*donor
+            for i, di := range order {
+                if i%*folds == f {
+                    test = append(test, donors[di])
+                } else {
+                    train = append(train, donors[di])
+                }
+            }
+            m := fit(train)
+            log.Printf("fold %d/%d: %d features", f+1, *folds, len(m.Features))
+            ok := 0
+            for _, d := range test {
+                if predict(m, d) == d.class {
+                    ok++
+                }
+            }
+            correct += ok
+            acc := float64(ok) / float64(len(test))
+            foldAcc = append(foldAcc, acc)
+            log.Printf("fold %d/%d: accuracy %.4f (%d/%d)", f+1, *folds, acc, ok, len(test))
+        }
+        cvAccuracy = float64(correct) / float64(len(donors))
+        fmt.Printf("cross-validated accuracy (%d folds): %.4f\n", *folds, cvAccuracy)
+    }
+
+    // 3) Final model on all donors
+    m := fit(donors)
+    m.CVAccuracy = cvAccuracy
+    m.CVFolds = foldAcc
+    m.TrainedAt = time.Now().UTC()
+
+    f, err := os.Create(*out)
+    if err != nil {
+        return err
+    }
+    if err := json.NewEncoder(f).Encode(m); err != nil {
+        f.Close()
+        return err
+    }
+    if err := f.Close(); err != nil {
+        return err
+    }
+    log.Printf("Model written to %s", *out)
+    return nil
+}
+
+// ------------------------------------------------------------------
+// classifyHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: POST /classify  {"neomers": ["ACGT...", ...], "top": 10}
+//
+// Scores a sample's neomer list with the loaded classifier and returns
+// the class probabilities and the neomers contributing most to the top
+// class (log-odds of the top class minus the mean over all classes).
+//
+func classifyHandler(c *gin.Context) {
+    var req struct {
+        Neomers []string `json:"neomers"`
+        Top     int      `json:"top"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body: " + err.Error()})
+        return
+    }
+    if len(req.Neomers) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing neomers"})
+        return
+    }
+    if req.Top <= 0 || req.Top > 1000 {
+        req.Top = 10
+    }
+
+    classifierMu.RLock()
+    m, loadErr := classifier, classifierErr
+    classifierMu.RUnlock()
+    if m == nil {
+        message := "classifier is not loaded (set NEOMERS_CLASSIFIER_MODEL)"
+        if loadErr != nil {
+            message = loadErr.Error()
+        }
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": message})
+        return
+    }
+
+    seen := map[string]bool{}
+    var neomers []string
+    known := 0
+    for _, raw := range req.Neomers {
+        seq, err := normalizeSequence(raw)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if seen[seq] {
+            continue
+        }
+        seen[seq] = true
+        neomers = append(neomers, seq)
+        if _, ok := m.logOdds[seq]; ok {
+            known++
+        }
+    }
+
+    probs := m.score(neomers)
+    type classProb struct {
+        Class       string  `json:"class"`
+        Probability float64 `json:"probability"`
+    }
+    ranking := make([]classProb, len(m.Classes))
+    best := 0
+    for ci, cls := range m.Classes {
+        ranking[ci] = classProb{cls, probs[ci]}
+        if probs[ci] > probs[best] {
+            best = ci
+        }
+    }
+    sort.Slice(ranking, func(i, j int) bool { return ranking[i].Probability > ranking[j].Probability })
+
+    type contribution struct {
+        Neomer       string  `json:"neomer"`
+        Contribution float64 `json:"contribution"`
+    }
+    contributions := []contribution{}
+    for _, seq := range neomers {
+        odds, ok := m.logOdds[seq]
+        if !ok {
+            continue
+        }
+        mean := 0.0
+        for _, v := range odds {
+            mean += v
+        }
+        mean /= float64(len(odds))
+        contributions = append(contributions, contribution{seq, odds[best] - mean})
+    }
+    sort.Slice(contributions, func(i, j int) bool { return contributions[i].Contribution > contributions[j].Contribution })
+    if len(contributions) > req.Top {
+        contributions = contributions[:req.Top]
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "model": gin.H{
+            "K":          m.K,
+            "dataset":    m.Dataset,
+            "label":      m.Label,
+            "cvAccuracy": m.CVAccuracy,
+        },
+        "submitted":       len(neomers),
+        "knownNeomers":    known,
+        "prediction":      m.Classes[best],
+        "probabilities":   ranking,
+        "topContributors": contributions,
+    })
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestReadClassifierModel(t *testing.T) {
+    cases := []struct {
+        name  string
+        model string
+        err   string
+    }{
+        {"valid", `{"alpha": 1, "classes": ["BRCA", "LIHC"], "classDonors": [3, 2], "features": {"ACGTACGTACG": [2, 0]}}`, ""},
+        {"no classes", `{"alpha": 1, "classes": [], "classDonors": [], "features": {}}`, "no classes"},
+        {"short counts", `{"alpha": 1, "classes": ["BRCA", "LIHC"], "classDonors": [3, 2], "features": {"ACGTACGTACG": [2]}}`, "class counts"},
+        {"null counts", `{"alpha": 1, "classes": ["BRCA", "LIHC"], "classDonors": [3, 2], "features": {"ACGTACGTACG": null}}`, "class counts"},
+    }
+    for _, tc := range cases {
+        path := filepath.Join(t.TempDir(), "classifier.json")
+        if err := os.WriteFile(path, []byte(tc.model), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        m, err := readClassifierModel(path)
+        if tc.err == "" {
+            if err != nil {
+                t.Errorf("%s: %v", tc.name, err)
+            } else if probs := m.score([]string{"ACGTACGTACG"}); probs[0] <= probs[1] {
+                t.Errorf("%s: got %v, want BRCA more likely", tc.name, probs)
+            }
+            continue
+        }
+        if err == nil || !strings.Contains(err.Error(), tc.err) {
+            t.Errorf("%s: got error %v, want one containing %q", tc.name, err, tc.err)
+        }
+    }
+}
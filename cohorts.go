@@ -0,0 +1,411 @@
+package main
+
+import (
+    "bytes"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Cohorts
+// ------------------------------------------------------------------
+//
+// A cohort is a saved donor set of one dataset, defined by filters over
+// the donor's clinical row (see donorViewSQL), by an explicit list of
+// Actual_Donor_IDs, or both (their intersection). Definitions live in a
+// JSON file (NEOMERS_COHORTS_FILE, default cohorts.json). A cohort's
+// donor list is resolved against the database on first use and cached.
+//
+// Endpoints accepting "cohort=<id>" restrict their rows to its donors
+// through cohortDonorClause.
+
+type cohortFilter struct {
+    Column string      `json:"column"`
+    Op     string      `json:"op"`
+    Value  interface{} `json:"value,omitempty"`
+}
+
+type cohort struct {
+    ID          string         `json:"id"`
+    Name        string         `json:"name"`
+    Description string         `json:"description,omitempty"`
+    Dataset     string         `json:"dataset"`
+    Filters     []cohortFilter `json:"filters,omitempty"`
+    DonorIDs    []string       `json:"donorIds,omitempty"`
+    CreatedAt   time.Time      `json:"createdAt"`
+}
+
+var (
+    cohortsMu    sync.RWMutex
+    cohorts      = map[string]*cohort{}
+    cohortDonors = map[string][]string{} // resolved donor lists by cohort ID
+
+    errCohortNotFound = errors.New("cohort not found")
+)
+
+var cohortComparisons = map[string]string{
+    "=": "=", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+}
+
+func getCohortsPath() string {
+    if path := os.Getenv("NEOMERS_COHORTS_FILE"); path != "" {
+        return path
+    }
+    return "cohorts.json"
+}
+
+func loadCohorts(path string) {
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return
+    }
+    if err != nil {
+        log.Printf("Cohorts unavailable: %v", err)
+        return
+    }
+    var list []*cohort
+    if err := json.Unmarshal(data, &list); err != nil {
+        log.Printf("Cohorts unavailable: failed to decode %s: %v", path, err)
+        return
+    }
+
+    cohortsMu.Lock()
+    defer cohortsMu.Unlock()
+    for _, ch := range list {
+        cohorts[ch.ID] = ch
+    }
+    log.Printf("Loaded %d cohorts from %s", len(list), path)
+}
+
+// saveCohortsLocked rewrites the cohort file; cohortsMu must be held.
+func saveCohortsLocked() error {
+    list := make([]*cohort, 0, len(cohorts))
+    for _, ch := range cohorts {
+        list = append(list, ch)
+    }
+    sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+    var buf bytes.Buffer
+    enc := json.NewEncoder(&buf)
+    enc.SetEscapeHTML(false)
+    enc.SetIndent("", "  ")
+    if err := enc.Encode(list); err != nil {
+        return err
+    }
+    path := getCohortsPath()
+    if err := os.WriteFile(path+".tmp", buf.Bytes(), 0o644); err != nil {
+        return err
+    }
+    return os.Rename(path+".tmp", path)
+}
+
+// sql returns the condition of one filter on the donor view.
+func (f cohortFilter) sql(columns map[string]bool) (string, []interface{}, error) {
+    if !columns[f.Column] {
+        return "", nil, fmt.Errorf("unknown donor column '%s'", f.Column)
+    }
+    col := fmt.Sprintf(`"%s"`, f.Column)
+    switch f.Op {
+    case "in":
+        values, ok := f.Value.([]interface{})
+        if !ok || len(values) == 0 {
+            return "", nil, fmt.Errorf("filter on '%s': 'in' needs a non-empty list", f.Column)
+        }
+        return fmt.Sprintf("%s IN (%s)", col, sqlPlaceholders(len(values))), values, nil
+    case "between":
+        values, ok := f.Value.([]interface{})
+        if !ok || len(values) != 2 {
+            return "", nil, fmt.Errorf("filter on '%s': 'between' needs [min, max]", f.Column)
+        }
+        return col + " BETWEEN ? AND ?", values, nil
+    case "contains":
+        s, ok := f.Value.(string)
+        if !ok {
+            return "", nil, fmt.Errorf("filter on '%s': 'contains' needs a string", f.Column)
+        }
+        return fmt.Sprintf("contains(lower(CAST(%s AS VARCHAR)), lower(?))", col), []interface{}{s}, nil
+    case "is_null":
+        return col + " IS NULL", nil, nil
+    case "not_null":
+        return col + " IS NOT NULL", nil, nil
+    }
+    op, ok := cohortComparisons[f.Op]
+    if !ok {
+        return "", nil, fmt.Errorf("filter on '%s': unknown op '%s'", f.Column, f.Op)
+    }
+    if f.Value == nil {
+        return "", nil, fmt.Errorf("filter on '%s': missing value", f.Column)
+    }
+    return fmt.Sprintf("%s %s ?", col, op), []interface{}{f.Value}, nil
+}
+
+// resolveCohort returns the sorted Actual_Donor_IDs matching a cohort
+// definition.
+func resolveCohort(ch *cohort) ([]string, error) {
+    view, err := donorViewSQL(ch.Dataset)
+    if err != nil {
+        return nil, err
+    }
+    headers, _, err := queryTable(fmt.Sprintf("SELECT * FROM (%s) LIMIT 0", view))
+    if err != nil {
+        return nil, err
+    }
+    columns := make(map[string]bool, len(headers))
+    for _, h := range headers {
+        columns[h] = true
+    }
+
+    var conds []string
+    var args []interface{}
+    for _, f := range ch.Filters {
+        cond, fargs, err := f.sql(columns)
+        if err != nil {
+            return nil, err
+        }
+        conds = append(conds, cond)
+        args = append(args, fargs...)
+    }
+    if len(ch.DonorIDs) > 0 {
+        conds = append(conds, fmt.Sprintf("Actual_Donor_ID IN (%s)", sqlPlaceholders(len(ch.DonorIDs))))
+        for _, id := range ch.DonorIDs {
+            args = append(args, id)
+        }
+    }
+    where := ""
+    if len(conds) > 0 {
+        where = "WHERE " + strings.Join(conds, " AND ")
+    }
+
+    rows, err := db.Query(fmt.Sprintf(`
+        SELECT DISTINCT Actual_Donor_ID FROM (%s) %s ORDER BY Actual_Donor_ID
+    `, view, where), args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    donors := []string{}
+    for rows.Next() {
+        var id string
+        if err := rows.Scan(&id); err != nil {
+            return nil, err
+        }
+        donors = append(donors, id)
+    }
+    return donors, rows.Err()
+}
+
+// cohortDonorIDs returns a saved cohort and its (cached) donor list.
+func cohortDonorIDs(id string) (*cohort, []string, error) {
+    cohortsMu.RLock()
+    ch, ok := cohorts[id]
+    donors, resolved := cohortDonors[id]
+    cohortsMu.RUnlock()
+    if !ok {
+        return nil, nil, errCohortNotFound
+    }
+    if resolved {
+        return ch, donors, nil
+    }
+
+    donors, err := resolveCohort(ch)
+    if err != nil {
+        return nil, nil, err
+    }
+    cohortsMu.Lock()
+    if _, ok := cohorts[id]; ok {
+        cohortDonors[id] = donors
+    }
+    cohortsMu.Unlock()
+    return ch, donors, nil
+}
+
+// normalizeCohort defaults and checks a cohort definition.
+func normalizeCohort(ch *cohort) error {
+    if ch.Dataset == "" {
+        ch.Dataset = "genome"
+    }
+    if ch.Dataset != "genome" && ch.Dataset != "exome" {
+        return fmt.Errorf("unknown dataset '%s', expected 'genome' or 'exome'", ch.Dataset)
+    }
+    ids := ch.DonorIDs[:0]
+    for _, id := range ch.DonorIDs {
+        if id = strings.TrimSpace(id); id != "" {
+            ids = append(ids, id)
+        }
+    }
+    ch.DonorIDs = ids
+    if len(ch.Filters) == 0 && len(ch.DonorIDs) == 0 {
+        return fmt.Errorf("A cohort needs filters, donorIds or both")
+    }
+    return nil
+}
+
+// resolveCohortRef resolves either a saved cohort (when ref.ID is set)
+// or an inline, unsaved definition.
+func resolveCohortRef(ref cohort) (*cohort, []string, error) {
+    if ref.ID != "" {
+        return cohortDonorIDs(ref.ID)
+    }
+    if err := normalizeCohort(&ref); err != nil {
+        return nil, nil, err
+    }
+    donors, err := resolveCohort(&ref)
+    if err != nil {
+        return nil, nil, err
+    }
+    return &ref, donors, nil
+}
+
+// cohortDonorClause reads the optional "cohort" parameter and returns a
+// condition restricting column (an Actual_Donor_ID expression) to the
+// cohort's donors, or "" without a cohort. It writes the error response
+// itself when the cohort is unknown or belongs to another dataset.
+func cohortDonorClause(c *gin.Context, dataset, column string) (string, []interface{}, bool) {
+    id := c.Query("cohort")
+    if id == "" {
+        return "", nil, true
+    }
+    ch, donors, err := cohortDonorIDs(id)
+    if err == errCohortNotFound {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Cohort '%s' not found", id)})
+        return "", nil, false
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return "", nil, false
+    }
+    if ch.Dataset != dataset {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cohort '%s' is a %s cohort, not %s", id, ch.Dataset, dataset)})
+        return "", nil, false
+    }
+    if len(donors) == 0 {
+        return "FALSE", nil, true
+    }
+    args := make([]interface{}, len(donors))
+    for i, d := range donors {
+        args[i] = d
+    }
+    return fmt.Sprintf("%s IN (%s)", column, sqlPlaceholders(len(donors))), args, true
+}
+
+// ------------------------------------------------------------------
+// Cohort endpoints
+// ------------------------------------------------------------------
+//
+// POST   /cohorts      {"name": "female LIHC over 60", "dataset": "genome",
+//                       "filters": [{"column": "Cancer_Type", "op": "=", "value": "LIHC"},
+//                                   {"column": "donor_sex", "op": "=", "value": "female"},
+//                                   {"column": "donor_age_at_diagnosis", "op": ">", "value": 60}],
+//                       "donorIds": ["DO1234", ...]}
+// GET    /cohorts
+// GET    /cohorts/:id
+// DELETE /cohorts/:id
+//
+// Filter ops: =, !=, <, <=, >, >=, in, between, contains, is_null,
+// not_null. Filters are validated by resolving the cohort on creation.
+
+func createCohortHandler(c *gin.Context) {
+    var req cohort
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body: " + err.Error()})
+        return
+    }
+    req.Name = strings.TrimSpace(req.Name)
+    if req.Name == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing name"})
+        return
+    }
+    if err := normalizeCohort(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    donors, err := resolveCohort(&req)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    buf := make([]byte, 8)
+    if _, err := rand.Read(buf); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    req.ID = hex.EncodeToString(buf)
+    req.CreatedAt = time.Now().UTC()
+
+    cohortsMu.Lock()
+    cohorts[req.ID] = &req
+    cohortDonors[req.ID] = donors
+    err = saveCohortsLocked()
+    if err != nil {
+        delete(cohorts, req.ID)
+        delete(cohortDonors, req.ID)
+    }
+    cohortsMu.Unlock()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save cohort: " + err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusCreated, gin.H{"cohort": req, "donorCount": len(donors)})
+}
+
+func listCohortsHandler(c *gin.Context) {
+    cohortsMu.RLock()
+    list := make([]*cohort, 0, len(cohorts))
+    for _, ch := range cohorts {
+        list = append(list, ch)
+    }
+    cohortsMu.RUnlock()
+    sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+
+    c.JSON(http.StatusOK, gin.H{"cohorts": list})
+}
+
+func getCohortHandler(c *gin.Context) {
+    ch, donors, err := cohortDonorIDs(c.Param("id"))
+    if err == errCohortNotFound {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Cohort '%s' not found", c.Param("id"))})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "cohort":     ch,
+        "donorCount": len(donors),
+        "donors":     donors,
+    })
+}
+
+func deleteCohortHandler(c *gin.Context) {
+    id := c.Param("id")
+    cohortsMu.Lock()
+    defer cohortsMu.Unlock()
+    ch, ok := cohorts[id]
+    if !ok {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Cohort '%s' not found", id)})
+        return
+    }
+    delete(cohorts, id)
+    if err := saveCohortsLocked(); err != nil {
+        cohorts[id] = ch
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save cohorts: " + err.Error()})
+        return
+    }
+    delete(cohortDonors, id)
+    c.JSON(http.StatusOK, gin.H{"deleted": id})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// ------------------------------------------------------------------
+// Subcommands
+// ------------------------------------------------------------------
+//
+// Without arguments the binary runs the HTTP server. Offline jobs run
+// as subcommands instead, e.g.:
+//
+//     neomer_server train-classifier -K 16 -out classifier.json
+//
+// Each subcommand parses its own flags and opens the database itself.
+
+type subcommand struct {
+    Usage string
+    Run   func(args []string) error
+}
+
+var subcommands = map[string]subcommand{
+    "train-classifier": {
+        Usage: "train a cancer-type/organ classifier on neomer presence and save it to disk",
+        Run:   trainClassifierCommand,
+    },
+    "annotate-sbs96": {
+        Usage: "derive substitution type and trinucleotide context of neomer-creating mutations",
+        Run:   annotateSBS96Command,
+    },
+    "build-donor-counts": {
+        Usage: "precompute per-donor distinct neomer counts for the burden endpoint",
+        Run:   buildDonorCountsCommand,
+    },
+    "build-distributions": {
+        Usage: "precompute the per-cancer and per-organ donor-count distributions of neomers",
+        Run:   buildDistributionsCommand,
+    },
+}
+
+func runSubcommand(name string, args []string) error {
+    cmd, ok := subcommands[name]
+    if !ok {
+        return fmt.Errorf("unknown subcommand '%s'\n%s", name, subcommandsUsage())
+    }
+    return cmd.Run(args)
+}
+
+func subcommandsUsage() string {
+    names := make([]string, 0, len(subcommands))
+    for name := range subcommands {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var b strings.Builder
+    b.WriteString("available subcommands:\n")
+    for _, name := range names {
+        fmt.Fprintf(&b, "  %-20s %s\n", name, subcommands[name].Usage)
+    }
+    return b.String()
+}
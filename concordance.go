@@ -0,0 +1,201 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// getDatasetConcordanceHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /dataset_concordance?K=16&match=patient[&cancerType=...]
+//
+// Links donors present in both cohorts through the Tumor_Sample_Barcode
+// of donor_id_mapping and exomes_donor_id_mapping, either on the full
+// barcode (match=exact) or on the TCGA patient part (match=patient, the
+// default), see barcodeLinkSQL. For every linked donor it counts the
+// neomers found by WGS only, WES only and both at K, and sums them per
+// cancer type and over the whole cohort.
+//
+func getDatasetConcordanceHandler(c *gin.Context) {
+    k, err := strconv.Atoi(c.Query("K"))
+    if err != nil || k <= 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'K' must be a positive integer"})
+        return
+    }
+    for _, prefix := range []string{"neomers_", "exome_neomers_"} {
+        ks, err := availableKs(prefix)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        found := false
+        for _, available := range ks {
+            found = found || available == k
+        }
+        if !found {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("no %s%d table, available K: %v", prefix, k, ks)})
+            return
+        }
+    }
+
+    match := c.DefaultQuery("match", "patient")
+    genomeKey, err := barcodeLinkSQL("g", match)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    exomeKey, _ := barcodeLinkSQL("e", match)
+
+    where := ""
+    var args []interface{}
+    if ct := c.Query("cancerType"); ct != "" {
+        where = "WHERE l.Cancer_Type = ?"
+        args = append(args, ct)
+    }
+
+    // linked has a row per combination of the pair's mapping rows (one
+    // per sample); the counts are joined to the distinct pairs instead
+    query := fmt.Sprintf(`
+        WITH linked AS (
+            SELECT DISTINCT
+                g.Donor_ID        AS gid,
+                g.Actual_Donor_ID AS genome_donor,
+                e.Donor_ID        AS eid,
+                e.Actual_Donor_ID AS exome_donor,
+                d.Cancer_Type,
+                d.Organ
+            FROM donor_id_mapping g
+            JOIN exomes_donor_id_mapping e ON %s = %s
+            LEFT JOIN exome_donor_data d ON e.Actual_Donor_ID = d.bcr_patient_barcode
+        ),
+        pairs AS (
+            SELECT DISTINCT genome_donor, exome_donor, Cancer_Type, Organ
+            FROM linked
+        ),
+        lg AS (
+            SELECT DISTINCT l.genome_donor, l.exome_donor, n.nullomers_created
+            FROM linked l
+            JOIN neomers_%[3]d n ON CAST(n."Donor_ID" AS INT) = l.gid
+        ),
+        le AS (
+            SELECT DISTINCT l.genome_donor, l.exome_donor, n.nullomers_created
+            FROM linked l
+            JOIN exome_neomers_%[3]d n ON CAST(n."Donor_ID" AS INT) = l.eid
+        ),
+        cmp AS (
+            SELECT
+                COALESCE(lg.genome_donor, le.genome_donor) AS genome_donor,
+                COALESCE(lg.exome_donor, le.exome_donor)   AS exome_donor,
+                lg.nullomers_created IS NOT NULL           AS in_wgs,
+                le.nullomers_created IS NOT NULL           AS in_wes
+            FROM lg
+            FULL OUTER JOIN le
+              ON lg.genome_donor = le.genome_donor
+             AND lg.exome_donor = le.exome_donor
+             AND lg.nullomers_created = le.nullomers_created
+        )
+        SELECT
+            l.genome_donor,
+            l.exome_donor,
+            COALESCE(l.Cancer_Type, 'Unknown') AS cancer_type,
+            COALESCE(l.Organ, 'Unknown')       AS organ,
+            COUNT(*) FILTER (WHERE cmp.in_wgs AND NOT cmp.in_wes) AS wgs_only,
+            COUNT(*) FILTER (WHERE cmp.in_wes AND NOT cmp.in_wgs) AS wes_only,
+            COUNT(*) FILTER (WHERE cmp.in_wgs AND cmp.in_wes)     AS both_datasets
+        FROM pairs l
+        LEFT JOIN cmp USING (genome_donor, exome_donor)
+        %[4]s
+        GROUP BY ALL
+        ORDER BY cancer_type, l.genome_donor
+    `, genomeKey, exomeKey, k, where)
+
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    type linkedDonor struct {
+        GenomeDonor string `json:"genomeDonorId"`
+        ExomeDonor  string `json:"exomeDonorId"`
+        CancerType  string `json:"cancerType"`
+        Organ       string `json:"organ"`
+        concordance
+    }
+    type cancerSummary struct {
+        CancerType   string `json:"cancerType"`
+        LinkedDonors int    `json:"linkedDonors"`
+        concordance
+    }
+    donors := []linkedDonor{}
+    perCancer := map[string]*cancerSummary{}
+    overall := cancerSummary{CancerType: "All"}
+    for rows.Next() {
+        var d linkedDonor
+        if err := rows.Scan(&d.GenomeDonor, &d.ExomeDonor, &d.CancerType, &d.Organ, &d.WGSOnly, &d.WESOnly, &d.Both); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        d.Jaccard = d.jaccard()
+        donors = append(donors, d)
+
+        cs, ok := perCancer[d.CancerType]
+        if !ok {
+            cs = &cancerSummary{CancerType: d.CancerType}
+            perCancer[d.CancerType] = cs
+        }
+        cs.LinkedDonors++
+        cs.add(d.concordance)
+        overall.LinkedDonors++
+        overall.add(d.concordance)
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    cancerTypes := make([]cancerSummary, 0, len(perCancer))
+    for _, cs := range perCancer {
+        cs.Jaccard = cs.jaccard()
+        cancerTypes = append(cancerTypes, *cs)
+    }
+    sort.Slice(cancerTypes, func(i, j int) bool { return cancerTypes[i].CancerType < cancerTypes[j].CancerType })
+    overall.Jaccard = overall.jaccard()
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":           k,
+        "donors":      donors,
+        "cancerTypes": cancerTypes,
+        "summary":     overall,
+    })
+}
+
+// concordance counts the neomers seen in WGS only, WES only and both.
+type concordance struct {
+    WGSOnly int64   `json:"wgsOnly"`
+    WESOnly int64   `json:"wesOnly"`
+    Both    int64   `json:"both"`
+    Jaccard float64 `json:"jaccard"`
+}
+
+func (c *concordance) add(o concordance) {
+    c.WGSOnly += o.WGSOnly
+    c.WESOnly += o.WESOnly
+    c.Both += o.Both
+}
+
+// jaccard returns |both| / |union|.
+func (c concordance) jaccard() float64 {
+    union := c.WGSOnly + c.WESOnly + c.Both
+    if union == 0 {
+        return 0
+    }
+    return float64(c.Both) / float64(union)
+}
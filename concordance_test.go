@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestDatasetConcordanceSamplesPerDonor(t *testing.T) {
+    // DO1 has two tumour samples (internal IDs 1 and 2) linked to the
+    // exome donor TCGA-AA-0001; each neomer must be counted once per pair
+    useTestDB(t,
+        `CREATE TABLE donor_id_mapping (Donor_ID INTEGER, Actual_Donor_ID VARCHAR, Tumor_Sample_Barcode VARCHAR)`,
+        `INSERT INTO donor_id_mapping VALUES (1, 'DO1', 'TCGA-AA-0001-01A'), (2, 'DO1', 'TCGA-AA-0001-02A'), (3, 'DO2', 'TCGA-AA-0002-01A')`,
+        `CREATE TABLE exomes_donor_id_mapping (Donor_ID INTEGER, Actual_Donor_ID VARCHAR, Tumor_Sample_Barcode VARCHAR)`,
+        `INSERT INTO exomes_donor_id_mapping VALUES (10, 'TCGA-AA-0001', 'TCGA-AA-0001-01A'), (11, 'TCGA-AA-0002', 'TCGA-AA-0002-01A')`,
+        `CREATE TABLE exome_donor_data (bcr_patient_barcode VARCHAR, Cancer_Type VARCHAR, Organ VARCHAR)`,
+        `INSERT INTO exome_donor_data VALUES ('TCGA-AA-0001', 'LIHC', 'Liver'), ('TCGA-AA-0002', 'LIHC', 'Liver')`,
+        `CREATE TABLE neomers_11 (nullomers_created VARCHAR, Donor_ID VARCHAR)`,
+        `INSERT INTO neomers_11 VALUES ('AAAAAAAAAAA', '1'), ('CCCCCCCCCCC', '1'), ('CCCCCCCCCCC', '2'), ('GGGGGGGGGGG', '2'), ('AAAAAAAAAAA', '3')`,
+        `CREATE TABLE exome_neomers_11 (nullomers_created VARCHAR, Donor_ID VARCHAR)`,
+        `INSERT INTO exome_neomers_11 VALUES ('GGGGGGGGGGG', '10'), ('TTTTTTTTTTT', '10'), ('AAAAAAAAAAA', '11')`,
+    )
+
+    type counts struct {
+        GenomeDonor string `json:"genomeDonorId"`
+        WGSOnly     int64  `json:"wgsOnly"`
+        WESOnly     int64  `json:"wesOnly"`
+        Both        int64  `json:"both"`
+    }
+    cases := []struct {
+        match string
+        want  map[string]counts
+    }{
+        // Both DO1 samples share the patient barcode: WGS {A, C, G}, WES {G, T}
+        {"patient", map[string]counts{"DO1": {"DO1", 2, 1, 1}, "DO2": {"DO2", 0, 0, 1}}},
+        // Only sample 1 matches exactly: WGS {A, C}, WES {G, T}
+        {"exact", map[string]counts{"DO1": {"DO1", 2, 2, 0}, "DO2": {"DO2", 0, 0, 1}}},
+    }
+    for _, tc := range cases {
+        var resp struct {
+            Donors  []counts `json:"donors"`
+            Summary struct {
+                LinkedDonors int `json:"linkedDonors"`
+                counts
+            } `json:"summary"`
+        }
+        serveJSON(t, getDatasetConcordanceHandler, "/dataset_concordance?K=11&match="+tc.match, &resp)
+        if len(resp.Donors) != len(tc.want) || resp.Summary.LinkedDonors != len(tc.want) {
+            t.Errorf("%s: got %d donors (%d linked), want %d", tc.match, len(resp.Donors), resp.Summary.LinkedDonors, len(tc.want))
+        }
+        var total counts
+        for _, d := range resp.Donors {
+            if d != tc.want[d.GenomeDonor] {
+                t.Errorf("%s: got %+v, want %+v", tc.match, d, tc.want[d.GenomeDonor])
+            }
+            total.WGSOnly += d.WGSOnly
+            total.WESOnly += d.WESOnly
+            total.Both += d.Both
+        }
+        if s := resp.Summary.counts; s.WGSOnly != total.WGSOnly || s.WESOnly != total.WESOnly || s.Both != total.Both {
+            t.Errorf("%s: summary %+v, want the sum %+v", tc.match, s, total)
+        }
+    }
+}
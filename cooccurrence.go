@@ -0,0 +1,152 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// getCooccurrenceHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /cooccurrence?K=16&dataset=genome&neomer=ACGT...&limit=50
+//           /cooccurrence?K=16&dataset=genome&gene=TP53&limit=50
+//
+// The seed donors are the donors (Actual_Donor_ID) carrying the seed
+// neomer, or any neomer of the seed gene. Returns the neomers carried
+// by most seed donors, with the observed co-occurrence count, the count
+// expected if the neomer were independent of the seed, and one-sided
+// Fisher exact p-values for co-occurrence and mutual exclusivity.
+//
+func getCooccurrenceHandler(c *gin.Context) {
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    source, _ := neomerSourceSQL(dataset, k)
+
+    neomer := c.Query("neomer")
+    gene := c.Query("gene")
+    var seedCond, excludeCond string
+    var seedArg interface{}
+    switch {
+    case neomer != "" && gene == "":
+        neomer, err = normalizeSequence(neomer)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if len(neomer) != k {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Neomer length %d does not match K=%d", len(neomer), k)})
+            return
+        }
+        seedCond = "nullomers_created = ?"
+        excludeCond = "co.nullomers_created <> ?"
+        seedArg = neomer
+    case gene != "" && neomer == "":
+        seedCond = "Hugo_Symbol = ?"
+        excludeCond = "co.nullomers_created NOT IN (SELECT nullomers_created FROM src WHERE Hugo_Symbol = ?)"
+        seedArg = gene
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of 'neomer' or 'gene' is required"})
+        return
+    }
+
+    limit := 50
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 1000 {
+        limit = l
+    }
+
+    // —— Cohort size and seed donor count ——
+    var totalDonors, seedDonors int64
+    sizeQuery := fmt.Sprintf(`
+        WITH src AS (%s)
+        SELECT
+            COUNT(DISTINCT Actual_Donor_ID),
+            COUNT(DISTINCT Actual_Donor_ID) FILTER (WHERE %s)
+        FROM src
+    `, source, seedCond)
+    if err := db.QueryRow(sizeQuery, seedArg).Scan(&totalDonors, &seedDonors); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching donor counts: " + err.Error()})
+        return
+    }
+    if seedDonors == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Seed not found in any donor"})
+        return
+    }
+
+    // —— Co-occurring neomers ——
+    query := fmt.Sprintf(`
+        WITH src AS (%s),
+        pairs AS (
+            SELECT DISTINCT nullomers_created, Actual_Donor_ID FROM src
+        ),
+        seed AS (
+            SELECT DISTINCT Actual_Donor_ID FROM src WHERE %s
+        ),
+        carriers AS (
+            SELECT nullomers_created, COUNT(*) AS carriers
+            FROM pairs
+            GROUP BY nullomers_created
+        ),
+        co AS (
+            SELECT p.nullomers_created, COUNT(*) AS cooccurrence
+            FROM pairs p
+            JOIN seed USING (Actual_Donor_ID)
+            GROUP BY p.nullomers_created
+        )
+        SELECT co.nullomers_created, co.cooccurrence, ca.carriers
+        FROM co
+        JOIN carriers ca USING (nullomers_created)
+        WHERE %s
+        ORDER BY co.cooccurrence DESC, ca.carriers ASC, co.nullomers_created
+        LIMIT %d
+    `, source, seedCond, excludeCond, limit)
+
+    rows, err := db.Query(query, seedArg, seedArg)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching co-occurrence: " + err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    type cooccurrence struct {
+        Neomer       string  `json:"neomer"`
+        Cooccurrence int64   `json:"cooccurrence"`
+        Carriers     int64   `json:"carriers"`
+        Expected     float64 `json:"expected"`
+        LogOddsRatio float64 `json:"logOddsRatio"`
+        PCooccur     float64 `json:"pCooccurrence"`
+        PExclusive   float64 `json:"pExclusivity"`
+    }
+    results := []cooccurrence{}
+    for rows.Next() {
+        var r cooccurrence
+        if err := rows.Scan(&r.Neomer, &r.Cooccurrence, &r.Carriers); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning co-occurrence row: " + err.Error()})
+            return
+        }
+        r.Expected = float64(seedDonors) * float64(r.Carriers) / float64(totalDonors)
+        r.LogOddsRatio = logOddsRatio(r.Cooccurrence, totalDonors, seedDonors, r.Carriers)
+        r.PExclusive, r.PCooccur = hypergeomTails(r.Cooccurrence, totalDonors, seedDonors, r.Carriers)
+        results = append(results, r)
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating co-occurrence: " + err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":            k,
+        "dataset":      dataset,
+        "seedNeomer":   neomer,
+        "seedGene":     gene,
+        "seedDonors":   seedDonors,
+        "totalDonors":  totalDonors,
+        "cooccurrence": results,
+    })
+}
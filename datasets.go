@@ -0,0 +1,392 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Dataset & table helpers
+// ------------------------------------------------------------------
+//
+// The genome dataset lives in neomers_K tables, the exome dataset in
+// exome_neomers_K tables. Handlers that work on either take a
+// "dataset" query parameter ("genome" by default, or "exome").
+
+var sequenceRe = regexp.MustCompile(`^[ACGTN]+$`)
+
+// neomerTablePrefix maps the dataset parameter to its table prefix.
+func neomerTablePrefix(dataset string) (string, error) {
+    switch dataset {
+    case "", "genome":
+        return "neomers_", nil
+    case "exome":
+        return "exome_neomers_", nil
+    }
+    return "", fmt.Errorf("unknown dataset '%s', expected 'genome' or 'exome'", dataset)
+}
+
+// availableKs returns the sorted K values for which a <prefix><K> table exists.
+func availableKs(prefix string) ([]int, error) {
+    rows, err := db.Query(`
+        SELECT table_name
+        FROM information_schema.tables
+        WHERE table_name LIKE ?
+    `, prefix+"%")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var ks []int
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            return nil, err
+        }
+        if !strings.HasPrefix(name, prefix) {
+            continue
+        }
+        if k, err := strconv.Atoi(strings.TrimPrefix(name, prefix)); err == nil {
+            ks = append(ks, k)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    sort.Ints(ks)
+    return ks, nil
+}
+
+// normalizeSequence upper-cases a nucleotide sequence and checks that it
+// only contains A, C, G, T or N.
+func normalizeSequence(seq string) (string, error) {
+    seq = strings.ToUpper(strings.TrimSpace(seq))
+    if !sequenceRe.MatchString(seq) {
+        return "", fmt.Errorf("invalid sequence '%s': only A, C, G, T and N are allowed", seq)
+    }
+    return seq, nil
+}
+
+// sqlPlaceholders returns "?, ?, ..." with n placeholders.
+func sqlPlaceholders(n int) string {
+    if n <= 0 {
+        return ""
+    }
+    return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// datasetKParams reads the "dataset" and "K" query parameters and checks
+// that the matching neomer table exists.
+func datasetKParams(c *gin.Context) (string, int, error) {
+    dataset := c.DefaultQuery("dataset", "genome")
+    prefix, err := neomerTablePrefix(dataset)
+    if err != nil {
+        return "", 0, err
+    }
+    k, err := strconv.Atoi(c.Query("K"))
+    if err != nil || k <= 0 {
+        return "", 0, fmt.Errorf("Parameter 'K' must be a positive integer")
+    }
+    ks, err := availableKs(prefix)
+    if err != nil {
+        return "", 0, err
+    }
+    for _, available := range ks {
+        if available == k {
+            return dataset, k, nil
+        }
+    }
+    return "", 0, fmt.Errorf("no %s%d table, available K: %v", prefix, k, ks)
+}
+
+// neomerSourceSQL returns a SELECT over one neomer table in which every
+// row carries the neomer columns (without the internal Donor_ID) plus
+// the donor's Actual_Donor_ID, Cancer_Type and Organ. It hides the fact
+// that the genome dataset classifies donors through Project_Code while
+// the exome dataset keeps Cancer_Type/Organ in exome_donor_data.
+func neomerSourceSQL(dataset string, k int) (string, error) {
+    prefix, err := neomerTablePrefix(dataset)
+    if err != nil {
+        return "", err
+    }
+    return neomerTableSourceSQL(dataset, fmt.Sprintf("%s%d", prefix, k))
+}
+
+// neomerTableSourceSQL is neomerSourceSQL for any table sharing the
+// neomer table layout of the dataset (e.g. derived annotation tables).
+func neomerTableSourceSQL(dataset, table string) (string, error) {
+    switch dataset {
+    case "", "genome":
+        return fmt.Sprintf(`
+            SELECT n.* EXCLUDE (Donor_ID), di.Actual_Donor_ID, c.Cancer_Type, c.Organ
+            FROM %s n
+            JOIN cancer_type_details c USING (Project_Code)
+            JOIN donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
+        `, table), nil
+    case "exome":
+        return fmt.Sprintf(`
+            SELECT n.* EXCLUDE (Donor_ID), di.Actual_Donor_ID, d.Cancer_Type, d.Organ
+            FROM %s n
+            JOIN exomes_donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
+            JOIN exome_donor_data d ON di.Actual_Donor_ID = d.bcr_patient_barcode
+        `, table), nil
+    }
+    return "", fmt.Errorf("unknown dataset '%s', expected 'genome' or 'exome'", dataset)
+}
+
+// neomerDonorSourceSQL extends neomerSourceSQL with gc_content and the
+// columns of the dataset's clinical table (those not already present),
+// so one row carries everything the listing endpoints can filter on. It
+// also returns the DuckDB type of every column.
+func neomerDonorSourceSQL(dataset string, k int) (string, map[string]string, error) {
+    source, err := neomerSourceSQL(dataset, k)
+    if err != nil {
+        return "", nil, err
+    }
+    headers, _, err := queryTable(fmt.Sprintf("SELECT * FROM (%s) LIMIT 0", source))
+    if err != nil {
+        return "", nil, err
+    }
+    present := map[string]bool{}
+    for _, h := range headers {
+        present[h] = true
+    }
+    tables, _ := datasetDonorTables(dataset)
+    clinical, err := tableColumns(tables.Clinical)
+    if err != nil {
+        return "", nil, err
+    }
+    var exclude []string
+    for col := range clinical {
+        if present[col] {
+            exclude = append(exclude, fmt.Sprintf(`"%s"`, col))
+        }
+    }
+    clinicalSQL := "d.*"
+    if len(exclude) > 0 {
+        sort.Strings(exclude)
+        clinicalSQL = fmt.Sprintf("d.* EXCLUDE (%s)", strings.Join(exclude, ", "))
+    }
+    query := fmt.Sprintf(`
+        SELECT s.*, %[1]s AS gc_content, %[2]s
+        FROM (%[3]s) s
+        LEFT JOIN %[4]s d ON d.%[5]s = s.Actual_Donor_ID
+    `, strings.ReplaceAll(gcContentSQL, "nullomers_created", "s.nullomers_created"), clinicalSQL, source, tables.Clinical, tables.ClinicalKey)
+
+    types, err := columnTypes(query)
+    if err != nil {
+        return "", nil, err
+    }
+    return query, types, nil
+}
+
+// columnTypes returns the DuckDB type of every column of a query.
+func columnTypes(query string) (map[string]string, error) {
+    rows, err := db.Query("DESCRIBE " + query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    cols, err := rows.Columns()
+    if err != nil {
+        return nil, err
+    }
+    types := map[string]string{}
+    for rows.Next() {
+        row := make([]interface{}, len(cols))
+        ptrs := make([]interface{}, len(cols))
+        for i := range row {
+            ptrs[i] = &row[i]
+        }
+        if err := rows.Scan(ptrs...); err != nil {
+            return nil, err
+        }
+        types[fmt.Sprint(row[0])] = fmt.Sprint(row[1])
+    }
+    return types, rows.Err()
+}
+
+// isNumericType reports whether a DuckDB column type is numeric.
+func isNumericType(t string) bool {
+    switch t {
+    case "TINYINT", "SMALLINT", "INTEGER", "BIGINT", "HUGEINT",
+        "UTINYINT", "USMALLINT", "UINTEGER", "UBIGINT", "FLOAT", "DOUBLE":
+        return true
+    }
+    return strings.HasPrefix(t, "DECIMAL")
+}
+
+// numericColumns reports which of cols of a query hold numbers: columns
+// of a numeric type, and VARCHAR columns whose non-null values all cast
+// to DOUBLE (clinical tables often store ages or days as text). Columns
+// of other types, or without values, are not numeric.
+func numericColumns(query string, types map[string]string, cols []string) (map[string]bool, error) {
+    numeric := map[string]bool{}
+    var text, exprs []string
+    for _, col := range cols {
+        switch {
+        case isNumericType(types[col]):
+            numeric[col] = true
+        case types[col] == "VARCHAR":
+            text = append(text, col)
+            exprs = append(exprs, fmt.Sprintf(`COUNT("%[1]s") > 0 AND COUNT("%[1]s") = COUNT(TRY_CAST("%[1]s" AS DOUBLE))`, col))
+        }
+    }
+    if len(text) == 0 {
+        return numeric, nil
+    }
+    result := make([]bool, len(text))
+    ptrs := make([]interface{}, len(text))
+    for i := range result {
+        ptrs[i] = &result[i]
+    }
+    if err := db.QueryRow(fmt.Sprintf("SELECT %s FROM (%s)", strings.Join(exprs, ", "), query)).Scan(ptrs...); err != nil {
+        return nil, err
+    }
+    for i, col := range text {
+        numeric[col] = result[i]
+    }
+    return numeric, nil
+}
+
+// donorTables names the per-donor tables of a dataset: the mapping from
+// the internal Donor_ID of the neomer tables to Actual_Donor_ID, and the
+// clinical table with one row per donor keyed by ClinicalKey.
+type donorTables struct {
+    Mapping     string
+    Clinical    string
+    ClinicalKey string
+}
+
+func datasetDonorTables(dataset string) (donorTables, error) {
+    switch dataset {
+    case "", "genome":
+        return donorTables{"donor_id_mapping", "donor_data", "icgc_donor_id"}, nil
+    case "exome":
+        return donorTables{"exomes_donor_id_mapping", "exome_donor_data", "bcr_patient_barcode"}, nil
+    }
+    return donorTables{}, fmt.Errorf("unknown dataset '%s', expected 'genome' or 'exome'", dataset)
+}
+
+// donorViewSQL returns a SELECT with one row per donor of the dataset,
+// however many samples it has: Actual_Donor_ID, every column of the
+// clinical table, Cancer_Type and Organ. Genome donors are classified
+// through the Project_Code of their neomer rows at any K.
+func donorViewSQL(dataset string) (string, error) {
+    switch dataset {
+    case "", "genome":
+        ks, err := availableKs("neomers_")
+        if err != nil {
+            return "", err
+        }
+        if len(ks) == 0 {
+            return `
+                SELECT m.Actual_Donor_ID, d.*, CAST(NULL AS VARCHAR) AS Cancer_Type, CAST(NULL AS VARCHAR) AS Organ
+                FROM (SELECT DISTINCT Actual_Donor_ID FROM donor_id_mapping) m
+                LEFT JOIN donor_data d ON d.icgc_donor_id = m.Actual_Donor_ID
+            `, nil
+        }
+        var parts []string
+        for _, k := range ks {
+            parts = append(parts, fmt.Sprintf(`SELECT DISTINCT CAST("Donor_ID" AS INT) AS did, Project_Code FROM neomers_%d`, k))
+        }
+        return fmt.Sprintf(`
+            SELECT m.Actual_Donor_ID, d.*, ct.Cancer_Type, ct.Organ
+            FROM (SELECT DISTINCT Actual_Donor_ID FROM donor_id_mapping) m
+            LEFT JOIN donor_data d ON d.icgc_donor_id = m.Actual_Donor_ID
+            LEFT JOIN (
+                SELECT s.Actual_Donor_ID, ANY_VALUE(n.Project_Code) AS Project_Code
+                FROM (%s) n
+                JOIN donor_id_mapping s ON s.Donor_ID = n.did
+                GROUP BY s.Actual_Donor_ID
+            ) p ON p.Actual_Donor_ID = m.Actual_Donor_ID
+            LEFT JOIN cancer_type_details ct ON ct.Project_Code = p.Project_Code
+        `, strings.Join(parts, " UNION ALL ")), nil
+    case "exome":
+        return `
+            SELECT m.Actual_Donor_ID, d.*
+            FROM (SELECT DISTINCT Actual_Donor_ID FROM exomes_donor_id_mapping) m
+            LEFT JOIN exome_donor_data d ON d.bcr_patient_barcode = m.Actual_Donor_ID
+        `, nil
+    }
+    return "", fmt.Errorf("unknown dataset '%s', expected 'genome' or 'exome'", dataset)
+}
+
+// barcodeLinkSQL returns the expression linking a mapping table row
+// (given its alias) to the other dataset: the full Tumor_Sample_Barcode
+// for match "exact", or its TCGA patient part (first 12 characters) for
+// match "patient", since WGS and WES aliquots of one tumour carry
+// different barcodes.
+func barcodeLinkSQL(alias, match string) (string, error) {
+    switch match {
+    case "exact":
+        return alias + ".Tumor_Sample_Barcode", nil
+    case "patient":
+        return fmt.Sprintf("CASE WHEN %[1]s.Tumor_Sample_Barcode LIKE 'TCGA-%%' THEN substr(%[1]s.Tumor_Sample_Barcode, 1, 12) ELSE %[1]s.Tumor_Sample_Barcode END", alias), nil
+    }
+    return "", fmt.Errorf("Parameter 'match' must be 'exact' or 'patient'")
+}
+
+// tableColumns returns the column names of a table, or an empty map if
+// the table does not exist.
+func tableColumns(table string) (map[string]bool, error) {
+    rows, err := db.Query(`
+        SELECT column_name
+        FROM information_schema.columns
+        WHERE table_name = ?
+    `, table)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    cols := map[string]bool{}
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            return nil, err
+        }
+        cols[name] = true
+    }
+    return cols, rows.Err()
+}
+
+// queryTable runs a query and returns its column names and rows in the
+// {"headers", "data"} shape the listing endpoints respond with.
+func queryTable(query string, args ...interface{}) ([]string, [][]interface{}, error) {
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer rows.Close()
+
+    cols, err := rows.Columns()
+    if err != nil {
+        return nil, nil, err
+    }
+    data := make([][]interface{}, 0)
+    for rows.Next() {
+        row := make([]interface{}, len(cols))
+        ptrs := make([]interface{}, len(cols))
+        for i := range row {
+            ptrs[i] = &row[i]
+        }
+        if err := rows.Scan(ptrs...); err != nil {
+            return nil, nil, err
+        }
+        for i, v := range row {
+            if b, ok := v.([]byte); ok {
+                row[i] = string(b)
+            }
+        }
+        data = append(data, row)
+    }
+    return cols, data, rows.Err()
+}
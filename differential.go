@@ -0,0 +1,258 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "net/http"
+    "sort"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// compareCohortsHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: POST /cohort_comparison
+//   {"K": 16,
+//    "cohortA": {"id": "<saved cohort>"},
+//    "cohortB": {"dataset": "genome", "filters": [...], "donorIds": [...]},
+//    "minCarriers": 2, "maxFDR": 0.05, "sortBy": "difference", "page": 0, "limit": 100}
+//
+// Neomers differentially present between two disjoint donor groups of
+// the same dataset. Each side is a saved cohort ("id") or an inline
+// cohort definition. For every neomer carried by at least minCarriers
+// donors of either group, the 2x2 table carriers/non-carriers x A/B gets
+// a two-sided Fisher exact p-value; FDR is Benjamini-Hochberg over all
+// tested neomers. Results are ranked by |fraction A - fraction B|
+// (sortBy=difference, default) or by p-value (sortBy=pvalue). The
+// summary counts shared and exclusive neomers over all neomers found.
+//
+func compareCohortsHandler(c *gin.Context) {
+    var req struct {
+        K           int     `json:"K"`
+        CohortA     cohort  `json:"cohortA"`
+        CohortB     cohort  `json:"cohortB"`
+        MinCarriers int64   `json:"minCarriers"`
+        MaxFDR      float64 `json:"maxFDR"`
+        SortBy      string  `json:"sortBy"`
+        Page        int     `json:"page"`
+        Limit       int     `json:"limit"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body: " + err.Error()})
+        return
+    }
+    if req.MinCarriers <= 0 {
+        req.MinCarriers = 1
+    }
+    if req.MaxFDR <= 0 || req.MaxFDR > 1 {
+        req.MaxFDR = 1
+    }
+    if req.SortBy == "" {
+        req.SortBy = "difference"
+    }
+    if req.SortBy != "difference" && req.SortBy != "pvalue" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'sortBy' must be 'difference' or 'pvalue'"})
+        return
+    }
+    if req.Page < 0 {
+        req.Page = 0
+    }
+    if req.Limit <= 0 || req.Limit > 10000 {
+        req.Limit = 100
+    }
+
+    // Resolve both groups
+    var groups [2][]string
+    var defs [2]*cohort
+    for i, ref := range []cohort{req.CohortA, req.CohortB} {
+        ch, donors, err := resolveCohortRef(ref)
+        if err == errCohortNotFound {
+            c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Cohort '%s' not found", ref.ID)})
+            return
+        }
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cohort%c: %v", 'A'+i, err)})
+            return
+        }
+        if len(donors) == 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cohort%c has no donors", 'A'+i)})
+            return
+        }
+        defs[i], groups[i] = ch, donors
+    }
+    dataset := defs[0].Dataset
+    if defs[1].Dataset != dataset {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Both cohorts must belong to the same dataset"})
+        return
+    }
+    inA := make(map[string]bool, len(groups[0]))
+    for _, d := range groups[0] {
+        inA[d] = true
+    }
+    overlap := 0
+    for _, d := range groups[1] {
+        if inA[d] {
+            overlap++
+        }
+    }
+    if overlap > 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The cohorts share %d donors; they must be disjoint", overlap)})
+        return
+    }
+
+    prefix, _ := neomerTablePrefix(dataset)
+    ks, err := availableKs(prefix)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    found := false
+    for _, k := range ks {
+        found = found || k == req.K
+    }
+    if !found {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("no %s%d table, available K: %v", prefix, req.K, ks)})
+        return
+    }
+    source, _ := neomerSourceSQL(dataset, req.K)
+
+    // Carriers per neomer in each group, in one query
+    var values []string
+    var args []interface{}
+    for i, donors := range groups {
+        for _, d := range donors {
+            values = append(values, fmt.Sprintf("(?, '%c')", 'A'+i))
+            args = append(args, d)
+        }
+    }
+    query := fmt.Sprintf(`
+        WITH grp(Actual_Donor_ID, g) AS (VALUES %s),
+        src AS (%s),
+        carriers AS (
+            SELECT DISTINCT s.nullomers_created, s.Actual_Donor_ID, grp.g
+            FROM src s
+            JOIN grp USING (Actual_Donor_ID)
+        )
+        SELECT
+            nullomers_created,
+            COUNT(*) FILTER (WHERE g = 'A'),
+            COUNT(*) FILTER (WHERE g = 'B')
+        FROM carriers
+        GROUP BY nullomers_created
+    `, strings.Join(values, ", "), source)
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    type diffNeomer struct {
+        Neomer       string  `json:"neomer"`
+        CarriersA    int64   `json:"carriersA"`
+        CarriersB    int64   `json:"carriersB"`
+        FractionA    float64 `json:"fractionA"`
+        FractionB    float64 `json:"fractionB"`
+        Difference   float64 `json:"difference"`
+        LogOddsRatio float64 `json:"logOddsRatio"`
+        PValue       float64 `json:"pValue"`
+        FDR          float64 `json:"fdr"`
+    }
+    nA, nB := int64(len(groups[0])), int64(len(groups[1]))
+    total := nA + nB
+    var tested []diffNeomer
+    var shared, onlyA, onlyB int64
+    pCache := map[[2]int64]float64{} // p depends only on the carrier counts
+    for rows.Next() {
+        var d diffNeomer
+        if err := rows.Scan(&d.Neomer, &d.CarriersA, &d.CarriersB); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        switch {
+        case d.CarriersA > 0 && d.CarriersB > 0:
+            shared++
+        case d.CarriersA > 0:
+            onlyA++
+        default:
+            onlyB++
+        }
+        if d.CarriersA+d.CarriersB < req.MinCarriers {
+            continue
+        }
+        d.FractionA = float64(d.CarriersA) / float64(nA)
+        d.FractionB = float64(d.CarriersB) / float64(nB)
+        d.Difference = d.FractionA - d.FractionB
+        carriers := d.CarriersA + d.CarriersB
+        d.LogOddsRatio = logOddsRatio(d.CarriersA, total, nA, carriers)
+        key := [2]int64{d.CarriersA, d.CarriersB}
+        p, ok := pCache[key]
+        if !ok {
+            p = fisherTwoSided(d.CarriersA, total, nA, carriers)
+            pCache[key] = p
+        }
+        d.PValue = p
+        tested = append(tested, d)
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    pvalues := make([]float64, len(tested))
+    for i, d := range tested {
+        pvalues[i] = d.PValue
+    }
+    for i, q := range benjaminiHochberg(pvalues) {
+        tested[i].FDR = q
+    }
+    significant := []diffNeomer{}
+    for _, d := range tested {
+        if d.FDR <= req.MaxFDR {
+            significant = append(significant, d)
+        }
+    }
+    sort.Slice(significant, func(i, j int) bool {
+        a, b := significant[i], significant[j]
+        da, db := math.Abs(a.Difference), math.Abs(b.Difference)
+        if req.SortBy == "pvalue" && a.PValue != b.PValue {
+            return a.PValue < b.PValue
+        }
+        if da != db {
+            return da > db
+        }
+        if a.PValue != b.PValue {
+            return a.PValue < b.PValue
+        }
+        return a.Neomer < b.Neomer
+    })
+
+    start := req.Page * req.Limit
+    if start > len(significant) {
+        start = len(significant)
+    }
+    end := start + req.Limit
+    if end > len(significant) {
+        end = len(significant)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":       req.K,
+        "dataset": dataset,
+        "cohortA": gin.H{"id": defs[0].ID, "name": defs[0].Name, "donors": nA},
+        "cohortB": gin.H{"id": defs[1].ID, "name": defs[1].Name, "donors": nB},
+        "summary": gin.H{
+            "neomers":     shared + onlyA + onlyB,
+            "shared":      shared,
+            "exclusiveA":  onlyA,
+            "exclusiveB":  onlyB,
+            "tested":      len(tested),
+            "significant": len(significant),
+        },
+        "totalCount": len(significant),
+        "neomers":    significant[start:end],
+    })
+}
@@ -0,0 +1,744 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// distributionBucket is one row of a donor-count distribution: the
+// number of neomers (NumNullomers) carried by exactly DonorCount donors.
+type distributionBucket struct {
+    DonorCount   int64 `json:"donorCount"`
+    NumNullomers int64 `json:"numNullomers"`
+}
+
+// gcContentSQL is the gc_content column of the listing endpoints, so
+// filters on it select the same rows everywhere.
+const gcContentSQL = `ROUND(
+    100.0 * (
+        LENGTH(nullomers_created)
+        - LENGTH(REPLACE(UPPER(nullomers_created), 'G', ''))
+        - LENGTH(REPLACE(UPPER(nullomers_created), 'C', ''))
+    ) / LENGTH(nullomers_created),
+    2
+) * -1`
+
+// liveDistribution computes the donor-count distribution of neomers_K /
+// exome_neomers_K directly, over the rows matching every condition in
+// conds (on the columns of neomerSourceSQL plus gc_content). Empty
+// conditions are skipped.
+func liveDistribution(dataset string, k int, conds []string, args []interface{}) ([]distributionBucket, error) {
+    source, err := neomerSourceSQL(dataset, k)
+    if err != nil {
+        return nil, err
+    }
+    var where []string
+    for _, cond := range conds {
+        if cond != "" {
+            where = append(where, cond)
+        }
+    }
+    whereSQL := ""
+    if len(where) > 0 {
+        whereSQL = "WHERE " + strings.Join(where, " AND ")
+    }
+
+    rows, err := db.Query(fmt.Sprintf(`
+        WITH src AS (SELECT *, %s AS gc_content FROM (%s)),
+        per_neomer AS (
+            SELECT nullomers_created, COUNT(DISTINCT Actual_Donor_ID) AS donor_count
+            FROM src
+            %s
+            GROUP BY nullomers_created
+        )
+        SELECT donor_count, COUNT(*) AS num_nullomers
+        FROM per_neomer
+        GROUP BY donor_count
+        ORDER BY donor_count
+    `, gcContentSQL, source, whereSQL), args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    data := []distributionBucket{}
+    for rows.Next() {
+        var b distributionBucket
+        if err := rows.Scan(&b.DonorCount, &b.NumNullomers); err != nil {
+            return nil, err
+        }
+        data = append(data, b)
+    }
+    return data, rows.Err()
+}
+
+// ------------------------------------------------------------------
+// Precomputed distributions
+// ------------------------------------------------------------------
+//
+// The build-distributions subcommand (re)creates, for every K and
+// dataset, distribution_neomer_K_per_cancer and _per_organ: for each
+// cancer type / organ, the number of neomers (num_nullomers) carried by
+// exactly donor_count of its donors. Exome tables are prefixed with
+// "exome_". Every table built gets a row in distributionMetadataTable
+// recording its source table, size and build time.
+
+const distributionMetadataTable = "distribution_neomer_metadata"
+
+// distributionGroups maps the table suffix of a precomputed distribution
+// to the column it is grouped by.
+var distributionGroups = []struct{ Suffix, Column string }{
+    {"cancer", "Cancer_Type"},
+    {"organ", "Organ"},
+}
+
+// distributionTable names the precomputed distribution table of a
+// dataset, K and group suffix.
+func distributionTable(dataset string, k int, suffix string) string {
+    table := fmt.Sprintf("distribution_neomer_%d_per_%s", k, suffix)
+    if dataset == "exome" {
+        table = "exome_" + table
+    }
+    return table
+}
+
+func buildDistributionsCommand(args []string) error {
+    fs := flag.NewFlagSet("build-distributions", flag.ContinueOnError)
+    dataset := fs.String("dataset", "", "genome or exome (both when empty)")
+    k := fs.Int("K", 0, "neomer length (0 for every available K)")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    datasets := []string{"genome", "exome"}
+    if *dataset != "" {
+        if _, err := neomerTablePrefix(*dataset); err != nil {
+            return err
+        }
+        datasets = []string{*dataset}
+    }
+    if err := initializeDatabase(); err != nil {
+        return err
+    }
+    defer db.Close()
+
+    if _, err := db.Exec(fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %s (
+            table_name    VARCHAR PRIMARY KEY,
+            dataset       VARCHAR,
+            K             INTEGER,
+            grouping      VARCHAR,
+            source_tables VARCHAR,
+            num_rows      BIGINT,
+            built_at      TIMESTAMP
+        )
+    `, distributionMetadataTable)); err != nil {
+        return err
+    }
+
+    for _, d := range datasets {
+        prefix, _ := neomerTablePrefix(d)
+        ks, err := availableKs(prefix)
+        if err != nil {
+            return err
+        }
+        if *k != 0 {
+            found := false
+            for _, available := range ks {
+                found = found || available == *k
+            }
+            if !found {
+                log.Printf("Skipping %s: no %s%d table", d, prefix, *k)
+                continue
+            }
+            ks = []int{*k}
+        }
+        if len(ks) == 0 {
+            log.Printf("Skipping %s: no %s tables", d, prefix+"K")
+            continue
+        }
+        tables, _ := datasetDonorTables(d)
+        sources := []string{tables.Mapping}
+        if d == "genome" {
+            sources = append(sources, "cancer_type_details")
+        } else {
+            sources = append(sources, tables.Clinical)
+        }
+
+        for _, kk := range ks {
+            source, _ := neomerSourceSQL(d, kk)
+            sourceTables := strings.Join(append([]string{fmt.Sprintf("%s%d", prefix, kk)}, sources...), ",")
+            for _, g := range distributionGroups {
+                table := distributionTable(d, kk, g.Suffix)
+                if err := buildDistributionTable(table, source, g.Column, d, kk, g.Suffix, sourceTables); err != nil {
+                    return fmt.Errorf("building %s: %w", table, err)
+                }
+            }
+        }
+    }
+    return nil
+}
+
+// buildDistributionTable replaces one precomputed distribution table and
+// its metadata row in a single transaction.
+func buildDistributionTable(table, source, column, dataset string, k int, grouping, sourceTables string) error {
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    if _, err := tx.Exec(fmt.Sprintf(`
+        CREATE OR REPLACE TABLE %[1]s AS
+        WITH per_neomer AS (
+            SELECT %[2]s, nullomers_created, COUNT(DISTINCT Actual_Donor_ID) AS donor_count
+            FROM (%[3]s)
+            WHERE %[2]s IS NOT NULL
+            GROUP BY %[2]s, nullomers_created
+        )
+        SELECT %[2]s, donor_count, COUNT(*) AS num_nullomers
+        FROM per_neomer
+        GROUP BY %[2]s, donor_count
+        ORDER BY %[2]s, donor_count
+    `, table, column, source)); err != nil {
+        tx.Rollback()
+        return err
+    }
+    var rows int64
+    if err := tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&rows); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if _, err := tx.Exec(fmt.Sprintf(`
+        INSERT OR REPLACE INTO %s
+        VALUES (?, ?, ?, ?, ?, ?, now())
+    `, distributionMetadataTable), table, dataset, k, grouping, sourceTables, rows); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    log.Printf("%s: %d rows from %s", table, rows, sourceTables)
+    return nil
+}
+
+// precomputedDistribution reads the distribution of one cancer type or
+// organ from its distributionTable. It reports false when the table does
+// not exist.
+func precomputedDistribution(dataset string, k int, group, column, value string) ([]distributionBucket, bool, error) {
+    table := distributionTable(dataset, k, group)
+    cols, err := tableColumns(table)
+    if err != nil || len(cols) == 0 {
+        return nil, false, err
+    }
+    rows, err := db.Query(fmt.Sprintf(`
+        SELECT donor_count, num_nullomers
+        FROM %s
+        WHERE %s = ?
+        ORDER BY donor_count
+    `, table, column), value)
+    if err != nil {
+        return nil, false, err
+    }
+    defer rows.Close()
+
+    data := []distributionBucket{}
+    for rows.Next() {
+        var b distributionBucket
+        if err := rows.Scan(&b.DonorCount, &b.NumNullomers); err != nil {
+            return nil, false, err
+        }
+        data = append(data, b)
+    }
+    return data, true, rows.Err()
+}
+
+// listingAndRe splits the listing endpoints' "filters" string into
+// conditions; listingConditionRe matches one of them, e.g.
+// `gc_content > 30` or `Hugo_Symbol = 'TP53'`.
+var (
+    listingAndRe       = regexp.MustCompile(`(?i)\s+AND\s+`)
+    listingConditionRe = regexp.MustCompile(`^"?([A-Za-z0-9_]+)"?\s*(<=|>=|!=|<>|=|<|>|(?i:not like|ilike|like))\s*(.+)$`)
+)
+
+// listingFilterConds translates the filter parameters of the listing
+// endpoints ("filters", and "column"/"filterType=between"/"value") into
+// parameterised conditions on the live distribution source. Columns of
+// the neomer rows (and gc_content) are filtered row by row; columns of
+// the dataset's clinical table select the donors whose clinical row
+// matches. Unknown columns are rejected.
+func listingFilterConds(c *gin.Context, dataset string, k int) ([]string, []interface{}, error) {
+    source, err := neomerSourceSQL(dataset, k)
+    if err != nil {
+        return nil, nil, err
+    }
+    headers, _, err := queryTable(fmt.Sprintf("SELECT * FROM (%s) LIMIT 0", source))
+    if err != nil {
+        return nil, nil, err
+    }
+    rowCols := map[string]bool{"gc_content": true}
+    for _, h := range headers {
+        rowCols[h] = true
+    }
+    tables, _ := datasetDonorTables(dataset)
+    clinicalCols, err := tableColumns(tables.Clinical)
+    if err != nil {
+        return nil, nil, err
+    }
+    return parseListingFilters(c, func(col, expr string) (string, error) {
+        switch {
+        case rowCols[col]:
+            return expr, nil
+        case clinicalCols[col]:
+            // A clinical column selects the donors whose row matches
+            return fmt.Sprintf(`Actual_Donor_ID IN (SELECT %s FROM %s WHERE %s)`, tables.ClinicalKey, tables.Clinical, expr), nil
+        }
+        return "", fmt.Errorf("unknown filter column '%s'", col)
+    })
+}
+
+// parseListingFilters parses the listing endpoints' filter parameters.
+// Every condition is built on its column and passed to resolve, which
+// rejects unknown columns or rewrites the condition.
+func parseListingFilters(c *gin.Context, resolve func(col, expr string) (string, error)) ([]string, []interface{}, error) {
+    var conds []string
+    var args []interface{}
+    if c.Query("filterType") == "between" && c.Query("column") != "" && c.Query("value") != "" {
+        col := cleanColumnName(c.Query("column"))
+        parts := strings.Split(c.Query("value"), ",")
+        if len(parts) != 2 {
+            return nil, nil, fmt.Errorf("Parameter 'value' must be 'min,max'")
+        }
+        lo, errLo := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+        hi, errHi := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+        if errLo != nil || errHi != nil {
+            return nil, nil, fmt.Errorf("Parameter 'value' must be two numbers")
+        }
+        cond, err := resolve(col, fmt.Sprintf(`CAST("%s" AS DOUBLE) BETWEEN ? AND ?`, col))
+        if err != nil {
+            return nil, nil, err
+        }
+        conds = append(conds, cond)
+        args = append(args, lo, hi)
+    } else if filters := c.Query("filters"); filters != "" {
+        for _, part := range listingAndRe.Split(filters, -1) {
+            part = strings.TrimSpace(removeParentheses(part))
+            m := listingConditionRe.FindStringSubmatch(part)
+            if m == nil {
+                return nil, nil, fmt.Errorf("cannot parse filter '%s'", part)
+            }
+            col, op := m[1], strings.ToUpper(m[2])
+            value := strings.Trim(strings.TrimSpace(m[3]), `'"`)
+            var expr string
+            var arg interface{}
+            if f, err := strconv.ParseFloat(value, 64); err == nil && !strings.Contains(op, "LIKE") {
+                expr, arg = fmt.Sprintf(`CAST("%s" AS DOUBLE) %s ?`, col, op), f
+            } else {
+                expr, arg = fmt.Sprintf(`CAST("%s" AS VARCHAR) %s ?`, col, op), value
+            }
+            cond, err := resolve(col, expr)
+            if err != nil {
+                return nil, nil, err
+            }
+            conds = append(conds, cond)
+            args = append(args, arg)
+        }
+    }
+    return conds, args, nil
+}
+
+// minDistinctPatients returns N of the listing endpoints' special filter
+// at_least_X_distinct_patients;N, or 0 without it.
+func minDistinctPatients(specialFilters string) int64 {
+    var n int64
+    for _, part := range strings.Split(specialFilters, "|") {
+        sf := strings.Split(part, ";")
+        if sf[0] == "at_least_X_distinct_patients" && len(sf) == 2 {
+            if v, err := strconv.ParseInt(sf[1], 10, 64); err == nil && v > n {
+                n = v
+            }
+        }
+    }
+    return n
+}
+
+// ------------------------------------------------------------------
+// distributionDataHandler
+// ------------------------------------------------------------------
+//
+// Shared by /distribution_neomer/:K/data_by_cancer_type and
+// /distribution_neomer/:K/data_by_organ. param is the query parameter
+// naming the group, column its column and group the suffix of the
+// precomputed table.
+//
+// Without filters the distribution is read from the precomputed table.
+// With any of the listing endpoints' filters ("filters", "column" +
+// "filterType=between" + "value", "specialFilters"), a saved "cohort",
+// or when the precomputed table does not exist (e.g. dataset=exome), it
+// is computed from neomers_K / exome_neomers_K; "mode" tells which.
+//
+func distributionDataHandler(c *gin.Context, param, column, group string) {
+    K := c.Param("K")
+    k, err := strconv.Atoi(K)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter K must be an integer"})
+        return
+    }
+    value := c.Query(param)
+    if value == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Missing %s query parameter", param)})
+        return
+    }
+    dataset := c.DefaultQuery("dataset", "genome")
+    if _, err := neomerTablePrefix(dataset); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    response := gin.H{
+        "K":       K,
+        "dataset": dataset,
+        param:     value,
+    }
+    minDonors := minDistinctPatients(c.Query("specialFilters"))
+    live := minDonors > 0 || c.Query("filters") != "" || c.Query("cohort") != "" ||
+        (c.Query("filterType") == "between" && c.Query("column") != "")
+
+    if !live {
+        data, found, err := precomputedDistribution(dataset, k, group, column, value)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Query failed, possibly no data for K=%s: %v", K, err)})
+            return
+        }
+        if found {
+            response["mode"] = "precomputed"
+            response["distribution"] = data
+            response["summary"] = summarizeDistribution(data)
+            c.JSON(http.StatusOK, response)
+            return
+        }
+    }
+
+    conds, args, err := listingFilterConds(c, dataset, k)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    cohortWhere, cohortArgs, ok := cohortDonorClause(c, dataset, "Actual_Donor_ID")
+    if !ok {
+        return
+    }
+    conds = append([]string{column + " = ?", cohortWhere}, conds...)
+    args = append(append([]interface{}{value}, cohortArgs...), args...)
+    data, err := liveDistribution(dataset, k, conds, args)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Query failed, possibly no data for K=%s: %v", K, err)})
+        return
+    }
+    if minDonors > 0 {
+        kept := []distributionBucket{}
+        for _, b := range data {
+            if b.DonorCount >= minDonors {
+                kept = append(kept, b)
+            }
+        }
+        data = kept
+    }
+    if id := c.Query("cohort"); id != "" {
+        response["cohort"] = id
+    }
+    response["mode"] = "live"
+    response["distribution"] = data
+    response["summary"] = summarizeDistribution(data)
+    c.JSON(http.StatusOK, response)
+}
+
+// distributionSummary describes the donor counts of the neomers of one
+// distribution: location and spread, Gini coefficient (0 when every
+// neomer is carried by as many donors, towards 1 when a few neomers are
+// carried by most of them) and the fraction of private neomers, carried
+// by a single donor.
+type distributionSummary struct {
+    Neomers         int64   `json:"neomers"`
+    Mean            float64 `json:"mean"`
+    Median          float64 `json:"median"`
+    P10             float64 `json:"p10"`
+    P25             float64 `json:"p25"`
+    P75             float64 `json:"p75"`
+    P90             float64 `json:"p90"`
+    Max             int64   `json:"max"`
+    Gini            float64 `json:"gini"`
+    PrivateFraction float64 `json:"privateFraction"`
+}
+
+// summarizeDistribution summarises buckets sorted by donor count, as if
+// each neomer's donor count were listed once.
+func summarizeDistribution(buckets []distributionBucket) distributionSummary {
+    var s distributionSummary
+    var total float64
+    for _, b := range buckets {
+        s.Neomers += b.NumNullomers
+        total += float64(b.DonorCount * b.NumNullomers)
+        if b.DonorCount == 1 {
+            s.PrivateFraction = float64(b.NumNullomers)
+        }
+        if b.DonorCount > s.Max {
+            s.Max = b.DonorCount
+        }
+    }
+    if s.Neomers == 0 {
+        return s
+    }
+    n := float64(s.Neomers)
+    s.Mean = total / n
+    s.PrivateFraction /= n
+
+    // valueAt returns the i-th (0-based) donor count in sorted order
+    valueAt := func(i int64) float64 {
+        for _, b := range buckets {
+            if i < b.NumNullomers {
+                return float64(b.DonorCount)
+            }
+            i -= b.NumNullomers
+        }
+        return float64(s.Max)
+    }
+    // quantile interpolates linearly between closest ranks, like percentile
+    quantile := func(p float64) float64 {
+        pos := p * (n - 1)
+        lo, hi := valueAt(int64(math.Floor(pos))), valueAt(int64(math.Ceil(pos)))
+        return lo + (hi-lo)*(pos-math.Floor(pos))
+    }
+    s.P10, s.P25, s.Median = quantile(0.10), quantile(0.25), quantile(0.5)
+    s.P75, s.P90 = quantile(0.75), quantile(0.90)
+
+    // Gini = 2 * sum(rank * x) / (n * sum(x)) - (n + 1) / n, ranks 1..n
+    // in ascending order; a bucket of w values after c smaller ones
+    // covers ranks c+1..c+w.
+    if total > 0 {
+        var weighted, c float64
+        for _, b := range buckets {
+            w := float64(b.NumNullomers)
+            weighted += float64(b.DonorCount) * (w*c + w*(w+1)/2)
+            c += w
+        }
+        s.Gini = 2*weighted/(n*total) - (n+1)/n
+    }
+    return s
+}
+
+// groupDistributions returns the distribution of every cancer type or
+// organ (group suffix "cancer" or "organ"), from the precomputed table
+// when it exists and from neomers_K / exome_neomers_K otherwise.
+func groupDistributions(dataset string, k int, group, column string) (map[string][]distributionBucket, error) {
+    table := distributionTable(dataset, k, group)
+    cols, err := tableColumns(table)
+    if err != nil {
+        return nil, err
+    }
+    query := fmt.Sprintf(`
+        SELECT %[1]s, donor_count, num_nullomers
+        FROM %[2]s
+        ORDER BY %[1]s, donor_count
+    `, column, table)
+    if len(cols) == 0 {
+        source, err := neomerSourceSQL(dataset, k)
+        if err != nil {
+            return nil, err
+        }
+        query = fmt.Sprintf(`
+            WITH per_neomer AS (
+                SELECT %[1]s, nullomers_created, COUNT(DISTINCT Actual_Donor_ID) AS donor_count
+                FROM (%[2]s)
+                WHERE %[1]s IS NOT NULL
+                GROUP BY %[1]s, nullomers_created
+            )
+            SELECT %[1]s, donor_count, COUNT(*) AS num_nullomers
+            FROM per_neomer
+            GROUP BY %[1]s, donor_count
+            ORDER BY %[1]s, donor_count
+        `, column, source)
+    }
+    rows, err := db.Query(query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    result := map[string][]distributionBucket{}
+    for rows.Next() {
+        var name string
+        var b distributionBucket
+        if err := rows.Scan(&name, &b.DonorCount, &b.NumNullomers); err != nil {
+            return nil, err
+        }
+        result[name] = append(result[name], b)
+    }
+    return result, rows.Err()
+}
+
+// distributionGroupParams reads ":K", "by" (cancer_type or organ) and
+// "dataset" for the summary and comparison endpoints. It writes the
+// error response itself.
+func distributionGroupParams(c *gin.Context) (dataset string, k int, group, column string, ok bool) {
+    k, err := strconv.Atoi(c.Param("K"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter K must be an integer"})
+        return
+    }
+    switch c.DefaultQuery("by", "cancer_type") {
+    case "cancer_type":
+        group, column = "cancer", "Cancer_Type"
+    case "organ":
+        group, column = "organ", "Organ"
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'by' must be 'cancer_type' or 'organ'"})
+        return
+    }
+    dataset = c.DefaultQuery("dataset", "genome")
+    prefix, err := neomerTablePrefix(dataset)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    ks, err := availableKs(prefix)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    for _, available := range ks {
+        if available == k {
+            return dataset, k, group, column, true
+        }
+    }
+    c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("no %s%d table, available K: %v", prefix, k, ks)})
+    return
+}
+
+// ------------------------------------------------------------------
+// getDistributionSummaryHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /distribution_neomer/:K/summary?by=cancer_type|organ[&dataset=genome|exome]
+//
+// summarizeDistribution of every cancer type or organ, ordered by name.
+//
+func getDistributionSummaryHandler(c *gin.Context) {
+    dataset, k, group, column, ok := distributionGroupParams(c)
+    if !ok {
+        return
+    }
+    dists, err := groupDistributions(dataset, k, group, column)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    type groupSummary struct {
+        Group string `json:"group"`
+        distributionSummary
+    }
+    result := make([]groupSummary, 0, len(dists))
+    for name, buckets := range dists {
+        result = append(result, groupSummary{name, summarizeDistribution(buckets)})
+    }
+    sort.Slice(result, func(i, j int) bool { return result[i].Group < result[j].Group })
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":       k,
+        "dataset": dataset,
+        "by":      column,
+        "groups":  result,
+    })
+}
+
+// ------------------------------------------------------------------
+// getDistributionCompareHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /distribution_neomer/:K/compare?a=LIHC&b=BRCA
+//           [&by=cancer_type|organ][&dataset=genome|exome]
+//
+// Two-sample Kolmogorov-Smirnov test between the donor-count
+// distributions of two cancer types (or organs): D is the largest gap
+// between their empirical CDFs, the p-value is asymptotic and
+// conservative since donor counts are discrete. Returns both summaries
+// and the CDFs at every donor count seen in either group.
+//
+func getDistributionCompareHandler(c *gin.Context) {
+    dataset, k, group, column, ok := distributionGroupParams(c)
+    if !ok {
+        return
+    }
+    a, b := c.Query("a"), c.Query("b")
+    if a == "" || b == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'a' or 'b' query parameter"})
+        return
+    }
+    dists, err := groupDistributions(dataset, k, group, column)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    for _, name := range []string{a, b} {
+        if len(dists[name]) == 0 {
+            c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No distribution for %s '%s' at K=%d", column, name, k)})
+            return
+        }
+    }
+    sa, sb := summarizeDistribution(dists[a]), summarizeDistribution(dists[b])
+
+    // Walk both bucket lists in donor-count order
+    type cdfPoint struct {
+        DonorCount int64   `json:"donorCount"`
+        CDFA       float64 `json:"cdfA"`
+        CDFB       float64 `json:"cdfB"`
+    }
+    cdf := []cdfPoint{}
+    var d float64
+    var at int64
+    var cumA, cumB int64
+    da, db := dists[a], dists[b]
+    for len(da) > 0 || len(db) > 0 {
+        x := int64(math.MaxInt64)
+        if len(da) > 0 {
+            x = da[0].DonorCount
+        }
+        if len(db) > 0 && db[0].DonorCount < x {
+            x = db[0].DonorCount
+        }
+        if len(da) > 0 && da[0].DonorCount == x {
+            cumA += da[0].NumNullomers
+            da = da[1:]
+        }
+        if len(db) > 0 && db[0].DonorCount == x {
+            cumB += db[0].NumNullomers
+            db = db[1:]
+        }
+        p := cdfPoint{x, float64(cumA) / float64(sa.Neomers), float64(cumB) / float64(sb.Neomers)}
+        if gap := math.Abs(p.CDFA - p.CDFB); gap > d {
+            d, at = gap, x
+        }
+        cdf = append(cdf, p)
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":       k,
+        "dataset": dataset,
+        "by":      column,
+        "a":       gin.H{"group": a, "summary": sa},
+        "b":       gin.H{"group": b, "summary": sb},
+        "ks": gin.H{
+            "d":          d,
+            "donorCount": at,
+            "pValue":     ksPValue(d, sa.Neomers, sb.Neomers),
+        },
+        "cdf": cdf,
+    })
+}
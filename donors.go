@@ -0,0 +1,315 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Donor queries
+// ------------------------------------------------------------------
+//
+// Filtered, sorted and paginated rows of the per-donor tables. Filters
+// use the listing endpoints' grammar ("filters", and "column" /
+// "filterType=between" / "value"), applied to the columns of the
+// queried table; orderBy and every filter column are validated against
+// it before they reach SQL.
+
+const donorSummaryTopValues = 20
+
+// donorRowsQuery holds the WHERE clause and its arguments of a donor
+// query, shared by the row and summary endpoints.
+type donorRowsQuery struct {
+    Source string
+    Types  map[string]string
+    Where  string
+    Args   []interface{}
+}
+
+// parseDonorRowsQuery describes source and reads the filter parameters
+// against its columns. With cohortDataset set, "cohort" restricts the
+// rows to the cohort's donors by Actual_Donor_ID. It writes the error
+// response itself.
+func parseDonorRowsQuery(c *gin.Context, source, cohortDataset string) (donorRowsQuery, bool) {
+    q := donorRowsQuery{Source: source}
+    types, err := columnTypes(source)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return q, false
+    }
+    q.Types = types
+    conds, args, err := parseListingFilters(c, func(col, expr string) (string, error) {
+        if types[col] == "" {
+            return "", fmt.Errorf("unknown filter column '%s'", col)
+        }
+        return expr, nil
+    })
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return q, false
+    }
+    if cohortDataset != "" {
+        cohortWhere, cohortArgs, ok := cohortDonorClause(c, cohortDataset, "Actual_Donor_ID")
+        if !ok {
+            return q, false
+        }
+        if cohortWhere != "" {
+            conds = append(conds, cohortWhere)
+            args = append(args, cohortArgs...)
+        }
+    }
+    if len(conds) > 0 {
+        q.Where = "WHERE " + strings.Join(conds, " AND ")
+    }
+    q.Args = args
+    return q, true
+}
+
+// donorRowsHandler serves one page of q's rows: "orderBy"
+// (col:asc|desc, comma-separated, default defaultOrder or source
+// order), "limit" and "page". defaultLimit 0 returns every row unless
+// a limit is given.
+func donorRowsHandler(c *gin.Context, q donorRowsQuery, defaultLimit int, defaultOrder string) {
+    var orderBy []string
+    for _, o := range strings.Split(c.Query("orderBy"), ",") {
+        if o = strings.TrimSpace(o); o == "" {
+            continue
+        }
+        name, dir := o, "ASC"
+        if i := strings.Index(o, ":"); i >= 0 {
+            name, dir = o[:i], strings.ToUpper(o[i+1:])
+        }
+        if dir != "ASC" && dir != "DESC" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("orderBy '%s': direction must be asc or desc", o)})
+            return
+        }
+        if q.Types[name] == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown orderBy column '%s'", name)})
+            return
+        }
+        orderBy = append(orderBy, fmt.Sprintf(`"%s" %s NULLS LAST`, name, dir))
+    }
+    if len(orderBy) == 0 && defaultOrder != "" {
+        orderBy = []string{defaultOrder}
+    }
+    limit, page := defaultLimit, 0
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 10000 {
+        limit = l
+    }
+    if p, err := strconv.Atoi(c.Query("page")); err == nil && p > 0 {
+        page = p
+    }
+
+    var totalCount int64
+    if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM (%s) %s", q.Source, q.Where), q.Args...).Scan(&totalCount); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    query := fmt.Sprintf("SELECT * FROM (%s) %s", q.Source, q.Where)
+    if len(orderBy) > 0 {
+        query += " ORDER BY " + strings.Join(orderBy, ", ")
+    }
+    if limit > 0 {
+        query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, page*limit)
+    }
+    headers, data, err := queryTable(query, q.Args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "headers":    headers,
+        "data":       data,
+        "totalCount": totalCount,
+    })
+}
+
+// tableRowsHandler serves every row of a table, as headers and data,
+// with the optional filter, orderBy and paging parameters of donorRowsHandler.
+func tableRowsHandler(table string) func(*gin.Context) {
+    return func(c *gin.Context) {
+        q, ok := parseDonorRowsQuery(c, "SELECT * FROM "+table, "")
+        if !ok {
+            return
+        }
+        donorRowsHandler(c, q, 0, "")
+    }
+}
+
+// donorViewParams reads "dataset" and returns the donor view's query.
+func donorViewParams(c *gin.Context) (string, string, bool) {
+    dataset := c.DefaultQuery("dataset", "genome")
+    view, err := donorViewSQL(dataset)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return "", "", false
+    }
+    return dataset, view, true
+}
+
+// ------------------------------------------------------------------
+// getDonorsHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /donors?dataset=genome&orderBy=donor_age_at_diagnosis:desc
+//                  &limit=100&page=0
+//                  [&filters=...&column=...&filterType=between&value=...&cohort=...]
+//
+// One row per donor of the dataset (Actual_Donor_ID, the clinical
+// columns, Cancer_Type and Organ, as used by cohorts), filtered with
+// the listing endpoints' grammar on those columns. Returns headers,
+// data and totalCount, the number of matching donors. Pages hold
+// "limit" donors (default 100, at most 10000); the default order is
+// by Actual_Donor_ID.
+//
+func getDonorsHandler(c *gin.Context) {
+    dataset, view, ok := donorViewParams(c)
+    if !ok {
+        return
+    }
+    q, ok := parseDonorRowsQuery(c, view, dataset)
+    if !ok {
+        return
+    }
+    donorRowsHandler(c, q, 100, "Actual_Donor_ID")
+}
+
+// ------------------------------------------------------------------
+// getDonorsSummaryHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /donors/summary?dataset=genome&fields=donor_sex,donor_age_at_diagnosis
+//                          &top=20
+//                          [&filters=...&column=...&filterType=between&value=...&cohort=...]
+//
+// Per-field value summaries of the donors matching the same filters as
+// /donors, e.g. to fill filter controls. Every field reports its
+// non-null count, nulls and distinct values; numeric fields (including
+// text columns holding only numbers) add min, max, mean and median,
+// other fields their "top" most frequent values with counts (default
+// 20). Without fields every column but
+// Actual_Donor_ID and the clinical key is summarized.
+//
+func getDonorsSummaryHandler(c *gin.Context) {
+    dataset, view, ok := donorViewParams(c)
+    if !ok {
+        return
+    }
+    q, ok := parseDonorRowsQuery(c, view, dataset)
+    if !ok {
+        return
+    }
+    top := donorSummaryTopValues
+    if t, err := strconv.Atoi(c.Query("top")); err == nil && t > 0 && t <= 1000 {
+        top = t
+    }
+
+    var fields []string
+    if c.Query("fields") == "" {
+        tables, _ := datasetDonorTables(dataset)
+        for col := range q.Types {
+            if col != "Actual_Donor_ID" && col != tables.ClinicalKey {
+                fields = append(fields, col)
+            }
+        }
+        sort.Strings(fields)
+    }
+    for _, col := range strings.Split(c.Query("fields"), ",") {
+        if col = strings.TrimSpace(col); col == "" {
+            continue
+        }
+        if q.Types[col] == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown field '%s'", col)})
+            return
+        }
+        fields = append(fields, col)
+    }
+
+    // Counts of every field, and the numeric statistics, in one pass
+    numeric, err := numericColumns(view, q.Types, fields)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var exprs []string
+    for _, col := range fields {
+        exprs = append(exprs, fmt.Sprintf(`COUNT("%[1]s"), COUNT(DISTINCT "%[1]s")`, col))
+        if numeric[col] {
+            exprs = append(exprs, fmt.Sprintf(`MIN(CAST("%[1]s" AS DOUBLE)), MAX(CAST("%[1]s" AS DOUBLE)),
+                AVG(CAST("%[1]s" AS DOUBLE)), MEDIAN(CAST("%[1]s" AS DOUBLE))`, col))
+        }
+    }
+    exprs = append(exprs, "COUNT(*)")
+    _, rows, err := queryTable(fmt.Sprintf("SELECT %s FROM (%s) %s", strings.Join(exprs, ", "), q.Source, q.Where), q.Args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    row := rows[0]
+    total, _ := row[len(row)-1].(int64)
+
+    summaries := gin.H{}
+    i := 0
+    for _, col := range fields {
+        count, _ := row[i].(int64)
+        s := gin.H{
+            "count":    count,
+            "nulls":    total - count,
+            "distinct": row[i+1],
+        }
+        i += 2
+        if numeric[col] {
+            s["type"] = "numeric"
+            s["min"], s["max"], s["mean"], s["median"] = row[i], row[i+1], row[i+2], row[i+3]
+            i += 4
+        } else {
+            values, err := topDonorValues(q, col, top)
+            if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            s["type"] = "categorical"
+            s["values"] = values
+        }
+        summaries[col] = s
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "dataset": dataset,
+        "donors":  total,
+        "fields":  summaries,
+    })
+}
+
+// topDonorValues returns the limit most frequent non-null values of col
+// among q's rows, with their counts.
+func topDonorValues(q donorRowsQuery, col string, limit int) ([]valueCount, error) {
+    rows, err := db.Query(fmt.Sprintf(`
+        SELECT CAST("%[1]s" AS VARCHAR) AS v, COUNT(*) AS cnt
+        FROM (%[2]s)
+        %[3]s
+        GROUP BY v
+        HAVING v IS NOT NULL
+        ORDER BY cnt DESC, v
+        LIMIT %[4]d
+    `, col, q.Source, q.Where, limit), q.Args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    values := []valueCount{}
+    for rows.Next() {
+        var v valueCount
+        if err := rows.Scan(&v.Value, &v.Count); err != nil {
+            return nil, err
+        }
+        values = append(values, v)
+    }
+    return values, rows.Err()
+}
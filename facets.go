@@ -0,0 +1,282 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// facetMeasures maps the "count" values of /facets to aggregates.
+var facetMeasures = map[string]string{
+    "rows":    "COUNT(*)",
+    "neomers": "COUNT(DISTINCT nullomers_created)",
+    "donors":  "COUNT(DISTINCT Actual_Donor_ID)",
+}
+
+// defaultFacets returns the filter sidebar's facets present in a
+// dataset: cancer type, organ, sex, project code and gene as values,
+// age at diagnosis in 10-year bins.
+func defaultFacets(types map[string]string) ([]string, map[string]float64) {
+    var categorical []string
+    for _, col := range []string{"Cancer_Type", "Organ", "donor_sex", "gender", "Project_Code", "Hugo_Symbol"} {
+        if types[col] != "" {
+            categorical = append(categorical, col)
+        }
+    }
+    numeric := map[string]float64{}
+    for _, col := range []string{"donor_age_at_diagnosis", "age_at_initial_pathologic_diagnosis"} {
+        if types[col] != "" {
+            numeric[col] = 10
+        }
+    }
+    return categorical, numeric
+}
+
+// ------------------------------------------------------------------
+// getFacetsHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /facets?dataset=genome&K=16
+//                  &facets=Cancer_Type,Organ,donor_sex
+//                  &numeric=donor_age_at_diagnosis:10,gc_content:5
+//                  &count=rows&limit=50
+//                  [&filters=...&column=...&filterType=between&value=...&cohort=...]
+//
+// Counts for a filter sidebar in one round trip: per value of every
+// categorical column in "facets", per bin of every numeric column in
+// "numeric" (column:binWidth, width 10 by default), and overall. All
+// are computed by one GROUPING SETS query over the rows matching the
+// listing endpoints' filters. "count" is rows (default), neomers
+// (distinct) or donors (distinct). Categorical facets keep their
+// "limit" most frequent values. Without facets and numeric, the
+// sidebar's default facets are returned.
+//
+func getFacetsHandler(c *gin.Context) {
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    countBy := c.DefaultQuery("count", "rows")
+    measure, ok := facetMeasures[countBy]
+    if !ok {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'count' must be 'rows', 'neomers' or 'donors'"})
+        return
+    }
+    limit := 50
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+        limit = l
+    }
+
+    source, types, err := neomerDonorSourceSQL(dataset, k)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    // Requested facets, validated against the source columns
+    var categorical []string
+    numeric := map[string]float64{}
+    if c.Query("facets") == "" && c.Query("numeric") == "" {
+        categorical, numeric = defaultFacets(types)
+    }
+    for _, col := range strings.Split(c.Query("facets"), ",") {
+        if col = strings.TrimSpace(col); col == "" {
+            continue
+        }
+        if types[col] == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown facet column '%s'", col)})
+            return
+        }
+        categorical = append(categorical, col)
+    }
+    for _, spec := range strings.Split(c.Query("numeric"), ",") {
+        if spec = strings.TrimSpace(spec); spec == "" {
+            continue
+        }
+        col, width := spec, 10.0
+        if i := strings.Index(spec, ":"); i >= 0 {
+            col = spec[:i]
+            if width, err = strconv.ParseFloat(spec[i+1:], 64); err != nil || width <= 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid bin width in '%s'", spec)})
+                return
+            }
+        }
+        if types[col] == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown numeric column '%s'", col)})
+            return
+        }
+        numeric[col] = width
+    }
+    numericCols := make([]string, 0, len(numeric))
+    for col := range numeric {
+        numericCols = append(numericCols, col)
+    }
+    sort.Strings(numericCols)
+    isNumeric, err := numericColumns(source, types, numericCols)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    for _, col := range numericCols {
+        if !isNumeric[col] {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("'%s' is not a numeric column", col)})
+            return
+        }
+    }
+
+    conds, args, err := listingFilterConds(c, dataset, k)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    cohortWhere, cohortArgs, ok := cohortDonorClause(c, dataset, "Actual_Donor_ID")
+    if !ok {
+        return
+    }
+    if cohortWhere != "" {
+        conds = append(conds, cohortWhere)
+        args = append(args, cohortArgs...)
+    }
+    whereSQL := ""
+    if len(conds) > 0 {
+        whereSQL = "WHERE " + strings.Join(conds, " AND ")
+    }
+
+    // One grouping set per facet plus the grand total
+    n := len(categorical) + len(numericCols)
+    var exprs, names, groupings, sets []string
+    for i, col := range categorical {
+        exprs = append(exprs, fmt.Sprintf(`CAST("%s" AS VARCHAR) AS f%d`, col, i))
+    }
+    for i, col := range numericCols {
+        exprs = append(exprs, fmt.Sprintf(`FLOOR(CAST("%s" AS DOUBLE) / %g) * %g AS f%d`, col, numeric[col], numeric[col], len(categorical)+i))
+    }
+    for i := 0; i < n; i++ {
+        names = append(names, fmt.Sprintf("f%d", i))
+        groupings = append(groupings, fmt.Sprintf("GROUPING(f%d)", i))
+        sets = append(sets, fmt.Sprintf("(f%d)", i))
+    }
+    sets = append(sets, "()")
+    selectFacets, selectGroupings, facetExprs := "", "", ""
+    if n > 0 {
+        selectFacets = strings.Join(names, ", ") + ","
+        selectGroupings = strings.Join(groupings, ", ") + ","
+        facetExprs = strings.Join(exprs, ", ") + ","
+    }
+    query := fmt.Sprintf(`
+        WITH f AS (
+            SELECT %s nullomers_created, Actual_Donor_ID
+            FROM (%s)
+            %s
+        )
+        SELECT %s %s %s
+        FROM f
+        GROUP BY GROUPING SETS (%s)
+    `, facetExprs, source, whereSQL, selectFacets, selectGroupings, measure, strings.Join(sets, ", "))
+
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    type facetValue struct {
+        Value interface{} `json:"value"`
+        Count int64       `json:"count"`
+    }
+    type bin struct {
+        Start float64 `json:"start"`
+        End   float64 `json:"end"`
+        Count int64   `json:"count"`
+    }
+    values := make([][]facetValue, len(categorical))
+    bins := make([][]bin, len(numericCols))
+    nulls := make([]int64, len(numericCols))
+    var total int64
+    for rows.Next() {
+        keys := make([]interface{}, n)
+        grouping := make([]int64, n)
+        var count int64
+        ptrs := make([]interface{}, 0, 2*n+1)
+        for i := range keys {
+            ptrs = append(ptrs, &keys[i])
+        }
+        for i := range grouping {
+            ptrs = append(ptrs, &grouping[i])
+        }
+        ptrs = append(ptrs, &count)
+        if err := rows.Scan(ptrs...); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+
+        // The facet of a row is the one column it is grouped by
+        facet := -1
+        for i, g := range grouping {
+            if g == 0 {
+                facet = i
+            }
+        }
+        switch {
+        case facet < 0:
+            total = count
+        case facet < len(categorical):
+            values[facet] = append(values[facet], facetValue{keys[facet], count})
+        default:
+            i := facet - len(categorical)
+            start, ok := keys[facet].(float64)
+            if !ok {
+                nulls[i] = count
+                continue
+            }
+            bins[i] = append(bins[i], bin{start, start + numeric[numericCols[i]], count})
+        }
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    facets := gin.H{}
+    for i, col := range categorical {
+        vs := values[i]
+        sort.Slice(vs, func(a, b int) bool {
+            if vs[a].Count != vs[b].Count {
+                return vs[a].Count > vs[b].Count
+            }
+            return fmt.Sprint(vs[a].Value) < fmt.Sprint(vs[b].Value)
+        })
+        distinct := len(vs)
+        if len(vs) > limit {
+            vs = vs[:limit]
+        }
+        if vs == nil {
+            vs = []facetValue{}
+        }
+        facets[col] = gin.H{"values": vs, "distinctValues": distinct}
+    }
+    histograms := gin.H{}
+    for i, col := range numericCols {
+        bs := bins[i]
+        sort.Slice(bs, func(a, b int) bool { return bs[a].Start < bs[b].Start })
+        if bs == nil {
+            bs = []bin{}
+        }
+        histograms[col] = gin.H{"binWidth": numeric[col], "bins": bs, "nulls": nulls[i]}
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":          k,
+        "dataset":    dataset,
+        "count":      countBy,
+        "total":      total,
+        "facets":     facets,
+        "histograms": histograms,
+    })
+}
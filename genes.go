@@ -0,0 +1,303 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// getGenesHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /genes?K=16&dataset=genome&sortBy=neomers&page=0&limit=100[&cancerType=...]
+//
+// Lists genes (Hugo_Symbol) ranked by number of distinct neomers or by
+// number of affected donors.
+//
+func getGenesHandler(c *gin.Context) {
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    source, _ := neomerSourceSQL(dataset, k)
+
+    orderBy := "distinct_neomers DESC, affected_donors DESC"
+    switch c.DefaultQuery("sortBy", "neomers") {
+    case "neomers":
+    case "donors":
+        orderBy = "affected_donors DESC, distinct_neomers DESC"
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'sortBy' must be 'neomers' or 'donors'"})
+        return
+    }
+
+    page := 0
+    limit := 100
+    if p, err := strconv.Atoi(c.Query("page")); err == nil && p >= 0 {
+        page = p
+    }
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 10000 {
+        limit = l
+    }
+
+    where := "WHERE Hugo_Symbol IS NOT NULL AND Hugo_Symbol <> ''"
+    var args []interface{}
+    if ct := c.Query("cancerType"); ct != "" {
+        where += " AND Cancer_Type = ?"
+        args = append(args, ct)
+    }
+
+    var totalCount int
+    countQuery := fmt.Sprintf(`
+        WITH src AS (%s)
+        SELECT COUNT(DISTINCT Hugo_Symbol) FROM src %s
+    `, source, where)
+    if err := db.QueryRow(countQuery, args...).Scan(&totalCount); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    query := fmt.Sprintf(`
+        WITH src AS (%s)
+        SELECT
+            Hugo_Symbol,
+            COUNT(DISTINCT nullomers_created) AS distinct_neomers,
+            COUNT(DISTINCT Actual_Donor_ID)   AS affected_donors,
+            COUNT(DISTINCT Cancer_Type)       AS cancer_types
+        FROM src
+        %s
+        GROUP BY Hugo_Symbol
+        ORDER BY %s, Hugo_Symbol
+        LIMIT %d OFFSET %d
+    `, source, where, orderBy, limit, page*limit)
+
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    type geneRow struct {
+        Gene            string `json:"gene"`
+        DistinctNeomers int64  `json:"distinctNeomers"`
+        AffectedDonors  int64  `json:"affectedDonors"`
+        CancerTypes     int64  `json:"cancerTypes"`
+    }
+    genes := []geneRow{}
+    for rows.Next() {
+        var g geneRow
+        if err := rows.Scan(&g.Gene, &g.DistinctNeomers, &g.AffectedDonors, &g.CancerTypes); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        genes = append(genes, g)
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":          k,
+        "dataset":    dataset,
+        "genes":      genes,
+        "totalCount": totalCount,
+    })
+}
+
+// ------------------------------------------------------------------
+// getGeneDetailsHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /gene_details?gene=TP53&K=16&dataset=genome&limit=100
+//
+// Returns the neomers of a gene with their donor counts, the number of
+// affected donors per cancer type (next to the cancer type's cohort
+// size), and the recurrence histogram (how many of the gene's neomers
+// are seen in exactly N donors).
+//
+func getGeneDetailsHandler(c *gin.Context) {
+    gene := c.Query("gene")
+    if gene == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing gene parameter"})
+        return
+    }
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    source, _ := neomerSourceSQL(dataset, k)
+
+    limit := 100
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 10000 {
+        limit = l
+    }
+
+    // —— Summary ——
+    var distinctNeomers, affectedDonors, cancerTypes int64
+    summaryQuery := fmt.Sprintf(`
+        WITH src AS (%s)
+        SELECT
+            COUNT(DISTINCT nullomers_created),
+            COUNT(DISTINCT Actual_Donor_ID),
+            COUNT(DISTINCT Cancer_Type)
+        FROM src
+        WHERE Hugo_Symbol = ?
+    `, source)
+    if err := db.QueryRow(summaryQuery, gene).Scan(&distinctNeomers, &affectedDonors, &cancerTypes); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching gene summary: " + err.Error()})
+        return
+    }
+
+    // —— Neomers of the gene ——
+    neomerQuery := fmt.Sprintf(`
+        WITH src AS (%s)
+        SELECT
+            nullomers_created,
+            COUNT(DISTINCT Actual_Donor_ID) AS donors,
+            COUNT(DISTINCT Cancer_Type)     AS cancer_types,
+            COUNT(*)                        AS occurrences
+        FROM src
+        WHERE Hugo_Symbol = ?
+        GROUP BY nullomers_created
+        ORDER BY donors DESC, nullomers_created
+        LIMIT %d
+    `, source, limit)
+    neomerRows, err := db.Query(neomerQuery, gene)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching gene neomers: " + err.Error()})
+        return
+    }
+    defer neomerRows.Close()
+
+    type geneNeomer struct {
+        Neomer      string `json:"neomer"`
+        Donors      int64  `json:"donors"`
+        CancerTypes int64  `json:"cancerTypes"`
+        Occurrences int64  `json:"occurrences"`
+    }
+    neomers := []geneNeomer{}
+    for neomerRows.Next() {
+        var n geneNeomer
+        if err := neomerRows.Scan(&n.Neomer, &n.Donors, &n.CancerTypes, &n.Occurrences); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning gene neomer row: " + err.Error()})
+            return
+        }
+        neomers = append(neomers, n)
+    }
+    if err := neomerRows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating gene neomers: " + err.Error()})
+        return
+    }
+
+    // —— Donors per cancer type ——
+    cancerQuery := fmt.Sprintf(`
+        WITH src AS (%s),
+        cohort AS (
+            SELECT Cancer_Type, COUNT(DISTINCT Actual_Donor_ID) AS cohort_donors
+            FROM src
+            GROUP BY Cancer_Type
+        )
+        SELECT
+            s.Cancer_Type,
+            COALESCE(ANY_VALUE(s.Organ), 'Unknown') AS organ,
+            COUNT(DISTINCT s.Actual_Donor_ID)       AS donors,
+            COUNT(DISTINCT s.nullomers_created)     AS neomers,
+            ANY_VALUE(co.cohort_donors)             AS cohort_donors
+        FROM src s
+        JOIN cohort co USING (Cancer_Type)
+        WHERE s.Hugo_Symbol = ?
+        GROUP BY s.Cancer_Type
+        ORDER BY donors DESC
+    `, source)
+    cancerRows, err := db.Query(cancerQuery, gene)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cancer breakdown: " + err.Error()})
+        return
+    }
+    defer cancerRows.Close()
+
+    type geneCancerType struct {
+        CancerType   string  `json:"cancerType"`
+        Organ        string  `json:"organ"`
+        Donors       int64   `json:"donors"`
+        Neomers      int64   `json:"neomers"`
+        CohortDonors int64   `json:"cohortDonors"`
+        Fraction     float64 `json:"fraction"`
+    }
+    breakdown := []geneCancerType{}
+    for cancerRows.Next() {
+        var b geneCancerType
+        if err := cancerRows.Scan(&b.CancerType, &b.Organ, &b.Donors, &b.Neomers, &b.CohortDonors); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning cancer breakdown row: " + err.Error()})
+            return
+        }
+        if b.CohortDonors > 0 {
+            b.Fraction = float64(b.Donors) / float64(b.CohortDonors)
+        }
+        breakdown = append(breakdown, b)
+    }
+    if err := cancerRows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating cancer breakdown: " + err.Error()})
+        return
+    }
+
+    // —— Recurrence histogram ——
+    recurrenceQuery := fmt.Sprintf(`
+        WITH src AS (%s),
+        per_neomer AS (
+            SELECT nullomers_created, COUNT(DISTINCT Actual_Donor_ID) AS donor_count
+            FROM src
+            WHERE Hugo_Symbol = ?
+            GROUP BY nullomers_created
+        )
+        SELECT donor_count, COUNT(*) AS num_neomers
+        FROM per_neomer
+        GROUP BY donor_count
+        ORDER BY donor_count
+    `, source)
+    recRows, err := db.Query(recurrenceQuery, gene)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching recurrence: " + err.Error()})
+        return
+    }
+    defer recRows.Close()
+
+    type bucket struct {
+        DonorCount int64 `json:"donorCount"`
+        NumNeomers int64 `json:"numNeomers"`
+    }
+    recurrence := []bucket{}
+    for recRows.Next() {
+        var b bucket
+        if err := recRows.Scan(&b.DonorCount, &b.NumNeomers); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning recurrence row: " + err.Error()})
+            return
+        }
+        recurrence = append(recurrence, b)
+    }
+    if err := recRows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating recurrence: " + err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "gene":    gene,
+        "K":       k,
+        "dataset": dataset,
+        "summary": gin.H{
+            "distinctNeomers": distinctNeomers,
+            "affectedDonors":  affectedDonors,
+            "cancerTypes":     cancerTypes,
+        },
+        "neomers":         neomers,
+        "cancerBreakdown": breakdown,
+        "recurrence":      recurrence,
+    })
+}
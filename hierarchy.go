@@ -0,0 +1,231 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "sort"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// getNeomerHierarchyHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /neomer_hierarchy?sequence=ACGT...&dataset=genome&limit=50
+//
+// Relates a sequence to its shorter and longer neomer relatives.
+// "root" is the sequence itself; its children are its two (k-1)-mers,
+// recursively down to the smallest available K. "supers" holds the
+// longer neomers containing the sequence, each nested under the
+// shorter super-neomer it extends. Every node carries its donor
+// prevalence at its own K. "minimalNeomers" lists the neomers in the
+// sub-tree that contain no shorter neomer themselves, i.e. the minimal
+// neomers that explain the mutation.
+//
+type hierarchyNode struct {
+    Sequence   string           `json:"sequence"`
+    K          int              `json:"k"`
+    IsNeomer   bool             `json:"isNeomer"`
+    DonorCount int64            `json:"donorCount"`
+    Children   []*hierarchyNode `json:"children,omitempty"`
+}
+
+func getNeomerHierarchyHandler(c *gin.Context) {
+    seq, err := normalizeSequence(c.Query("sequence"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    prefix, err := neomerTablePrefix(c.Query("dataset"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    limit := 50
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 1000 {
+        limit = l
+    }
+
+    ks, err := availableKs(prefix)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(ks) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no %sK tables found", prefix)})
+        return
+    }
+    hasK := make(map[int]bool, len(ks))
+    for _, k := range ks {
+        hasK[k] = true
+    }
+    minK, maxK := ks[0], ks[len(ks)-1]
+    L := len(seq)
+    if L < minK || L > maxK {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Sequence length must be between %d and %d", minK, maxK)})
+        return
+    }
+
+    // 1) Sub-k-mers: collect the distinct substrings per K, then look
+    //    them up with one query per table.
+    nodes := map[string]*hierarchyNode{}
+    var build func(s string) *hierarchyNode
+    build = func(s string) *hierarchyNode {
+        if n, ok := nodes[s]; ok {
+            return n
+        }
+        n := &hierarchyNode{Sequence: s, K: len(s)}
+        nodes[s] = n
+        if len(s) > minK {
+            n.Children = append(n.Children, build(s[:len(s)-1]))
+            if s[1:] != s[:len(s)-1] {
+                n.Children = append(n.Children, build(s[1:]))
+            }
+        }
+        return n
+    }
+    root := build(seq)
+
+    byK := map[int][]string{}
+    for s := range nodes {
+        if hasK[len(s)] {
+            byK[len(s)] = append(byK[len(s)], s)
+        }
+    }
+    for k, seqs := range byK {
+        args := make([]interface{}, len(seqs))
+        for i, s := range seqs {
+            args[i] = s
+        }
+        query := fmt.Sprintf(`
+            SELECT nullomers_created, COUNT(DISTINCT Donor_ID)
+            FROM %s%d
+            WHERE nullomers_created IN (%s)
+            GROUP BY nullomers_created
+        `, prefix, k, sqlPlaceholders(len(seqs)))
+        rows, err := db.Query(query, args...)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        for rows.Next() {
+            var s string
+            var donors int64
+            if err := rows.Scan(&s, &donors); err != nil {
+                rows.Close()
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            if n, ok := nodes[s]; ok {
+                n.IsNeomer = true
+                n.DonorCount = donors
+            }
+        }
+        err = rows.Err()
+        rows.Close()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    // 2) Minimal neomers: neomer nodes with no neomer anywhere below them.
+    neomerBelow := map[string]bool{}
+    var hasNeomerBelow func(n *hierarchyNode) bool
+    hasNeomerBelow = func(n *hierarchyNode) bool {
+        if v, ok := neomerBelow[n.Sequence]; ok {
+            return v
+        }
+        found := false
+        for _, ch := range n.Children {
+            if ch.IsNeomer || hasNeomerBelow(ch) {
+                found = true
+            }
+        }
+        neomerBelow[n.Sequence] = found
+        return found
+    }
+    minimal := []*hierarchyNode{}
+    for _, n := range nodes {
+        if n.IsNeomer && !hasNeomerBelow(n) {
+            minimal = append(minimal, &hierarchyNode{Sequence: n.Sequence, K: n.K, IsNeomer: true, DonorCount: n.DonorCount})
+        }
+    }
+    sort.Slice(minimal, func(i, j int) bool {
+        if minimal[i].K != minimal[j].K {
+            return minimal[i].K < minimal[j].K
+        }
+        return minimal[i].Sequence < minimal[j].Sequence
+    })
+
+    // 3) Super-k-mers: every longer neomer containing the sequence,
+    //    attached to the longest found super-neomer it contains.
+    supers := map[string]*hierarchyNode{}
+    topSupers := []*hierarchyNode{}
+    for _, k := range ks {
+        if k <= L {
+            continue
+        }
+        query := fmt.Sprintf(`
+            SELECT nullomers_created, COUNT(DISTINCT Donor_ID) AS donors
+            FROM %s%d
+            WHERE contains(nullomers_created, ?)
+            GROUP BY nullomers_created
+            ORDER BY donors DESC, nullomers_created
+            LIMIT %d
+        `, prefix, k, limit)
+        rows, err := db.Query(query, seq)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        for rows.Next() {
+            n := &hierarchyNode{K: k, IsNeomer: true}
+            if err := rows.Scan(&n.Sequence, &n.DonorCount); err != nil {
+                rows.Close()
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            if parent := findSuperParent(n.Sequence, seq, supers); parent != nil {
+                parent.Children = append(parent.Children, n)
+            } else {
+                topSupers = append(topSupers, n)
+            }
+            supers[n.Sequence] = n
+        }
+        err = rows.Err()
+        rows.Close()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "sequence":       seq,
+        "availableK":     ks,
+        "root":           root,
+        "supers":         topSupers,
+        "minimalNeomers": minimal,
+    })
+}
+
+// findSuperParent returns the longest already-found super-neomer that
+// is a substring of s and still contains seq, or nil.
+func findSuperParent(s, seq string, supers map[string]*hierarchyNode) *hierarchyNode {
+    for k := len(s) - 1; k > len(seq); k-- {
+        for i := 0; i+k <= len(s); i++ {
+            sub := s[i : i+k]
+            if !strings.Contains(sub, seq) {
+                continue
+            }
+            if n, ok := supers[sub]; ok {
+                return n
+            }
+        }
+    }
+    return nil
+}
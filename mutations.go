@@ -0,0 +1,307 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "log"
+    "net/http"
+    "sort"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Mutational context (SBS96) annotation
+// ------------------------------------------------------------------
+//
+// The annotate-sbs96 subcommand derives, for every neomer row, the
+// single base substitution that created it and its trinucleotide
+// context, and stores them in <table>_sbs96 (e.g. neomers_16_sbs96)
+// next to all original columns. Two sources are supported, detected
+// from the table's columns or given explicitly:
+//
+//   - a reference k-mer column (same length as the neomer): the mutated
+//     position is the single position where the two differ;
+//   - a mutation position column (position of the mutated base inside
+//     the neomer) together with Reference_Allele.
+//
+// The flanking bases come from the neomer itself, so mutations at the
+// first or last base of a neomer have no context and are skipped.
+// Substitutions are reported on the pyrimidine strand (C>A ... T>G).
+// When the table has Chromosome/Start_Position, a mutation_key column
+// lets the endpoint count each mutation once even though one mutation
+// creates several overlapping neomers.
+
+var (
+    refKmerColumnCandidates  = []string{"reference_kmer", "ref_kmer", "Reference_Kmer", "reference_sequence", "original_kmer"}
+    positionColumnCandidates = []string{"mutation_position", "Mutation_Position", "mut_position", "mutation_pos", "position_in_kmer"}
+)
+
+// sbs96Channels returns the 96 channels in the usual COSMIC order.
+func sbs96Channels() []string {
+    var channels []string
+    for _, sub := range []string{"C>A", "C>G", "C>T", "T>A", "T>C", "T>G"} {
+        for _, five := range "ACGT" {
+            for _, three := range "ACGT" {
+                channels = append(channels, fmt.Sprintf("%c[%s]%c", five, sub, three))
+            }
+        }
+    }
+    return channels
+}
+
+func firstColumn(cols map[string]bool, candidates []string) string {
+    for _, name := range candidates {
+        if cols[name] {
+            return name
+        }
+    }
+    return ""
+}
+
+func annotateSBS96Command(args []string) error {
+    fs := flag.NewFlagSet("annotate-sbs96", flag.ContinueOnError)
+    k := fs.Int("K", 0, "neomer length (0 for every available K)")
+    dataset := fs.String("dataset", "genome", "genome or exome")
+    refKmerCol := fs.String("refKmerColumn", "", "reference k-mer column (auto-detected when empty)")
+    positionCol := fs.String("positionColumn", "", "mutation position column (auto-detected when empty)")
+    positionBase := fs.Int("positionBase", 1, "whether the mutation position is 0- or 1-based")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if *positionBase != 0 && *positionBase != 1 {
+        return fmt.Errorf("-positionBase must be 0 or 1")
+    }
+    prefix, err := neomerTablePrefix(*dataset)
+    if err != nil {
+        return err
+    }
+    if err := initializeDatabase(); err != nil {
+        return err
+    }
+    defer db.Close()
+
+    ks := []int{*k}
+    if *k == 0 {
+        if ks, err = availableKs(prefix); err != nil {
+            return err
+        }
+    }
+    for _, kk := range ks {
+        table := fmt.Sprintf("%s%d", prefix, kk)
+        cols, err := tableColumns(table)
+        if err != nil {
+            return err
+        }
+        if len(cols) == 0 {
+            return fmt.Errorf("table %s does not exist", table)
+        }
+
+        // Mutated position (1-based) and reference base expressions
+        var posExpr, refExpr string
+        ref := *refKmerCol
+        pos := *positionCol
+        if ref == "" && pos == "" {
+            ref = firstColumn(cols, refKmerColumnCandidates)
+            if ref == "" {
+                pos = firstColumn(cols, positionColumnCandidates)
+            }
+        }
+        switch {
+        case ref != "":
+            if !cols[ref] {
+                return fmt.Errorf("%s has no column %s", table, ref)
+            }
+            diffs := fmt.Sprintf(`list_transform(range(1, %d), i -> substr(nullomers_created, i, 1) <> substr("%s", i, 1))`, kk+1, ref)
+            posExpr = fmt.Sprintf(`CASE WHEN length("%[1]s") = %[2]d AND list_count(list_filter(%[3]s, x -> x)) = 1 THEN list_position(%[3]s, true) END`, ref, kk, diffs)
+            refExpr = fmt.Sprintf(`substr("%s", p, 1)`, ref)
+        case pos != "":
+            if !cols[pos] || !cols["Reference_Allele"] {
+                return fmt.Errorf("%s needs columns %s and Reference_Allele", table, pos)
+            }
+            posExpr = fmt.Sprintf(`TRY_CAST("%s" AS INTEGER) + %d`, pos, 1-*positionBase)
+            refExpr = `upper("Reference_Allele")`
+        default:
+            log.Printf("Skipping %s: no reference k-mer or mutation position column", table)
+            continue
+        }
+
+        keyExpr := "nullomers_created"
+        if cols["Chromosome"] && cols["Start_Position"] {
+            keyExpr = `CAST("Chromosome" AS VARCHAR) || ':' || CAST("Start_Position" AS VARCHAR)`
+        }
+
+        out := table + "_sbs96"
+        stmt := fmt.Sprintf(`
+            CREATE OR REPLACE TABLE %[1]s AS
+            WITH m AS (
+                SELECT *, %[3]s AS p FROM %[2]s
+            ),
+            t AS (
+                SELECT
+                    * EXCLUDE (p),
+                    substr(nullomers_created, p - 1, 1) AS five,
+                    %[4]s                               AS ref,
+                    substr(nullomers_created, p, 1)     AS alt,
+                    substr(nullomers_created, p + 1, 1) AS three
+                FROM m
+                WHERE p > 1 AND p < %[5]d
+            ),
+            s AS (
+                SELECT
+                    * EXCLUDE (five, ref, alt, three),
+                    CASE WHEN ref IN ('C', 'T')
+                        THEN five || '[' || ref || '>' || alt || ']' || three
+                        ELSE translate(three, 'ACGT', 'TGCA') || '['
+                             || translate(ref, 'ACGT', 'TGCA') || '>'
+                             || translate(alt, 'ACGT', 'TGCA') || ']'
+                             || translate(five, 'ACGT', 'TGCA')
+                    END AS sbs96
+                FROM t
+                WHERE ref IN ('A', 'C', 'G', 'T') AND alt IN ('A', 'C', 'G', 'T') AND ref <> alt
+                  AND five IN ('A', 'C', 'G', 'T') AND three IN ('A', 'C', 'G', 'T')
+            )
+            SELECT *, substr(sbs96, 3, 3) AS substitution, %[6]s || ':' || substitution AS mutation_key
+            FROM s
+        `, out, table, posExpr, refExpr, kk, keyExpr)
+        if _, err := db.Exec(stmt); err != nil {
+            return fmt.Errorf("annotating %s: %w", table, err)
+        }
+
+        var annotated, total int64
+        if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", out)).Scan(&annotated); err != nil {
+            return fmt.Errorf("counting %s: %w", out, err)
+        }
+        if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&total); err != nil {
+            return fmt.Errorf("counting %s: %w", table, err)
+        }
+        log.Printf("%s: %d of %d rows annotated into %s", table, annotated, total, out)
+    }
+    return nil
+}
+
+// ------------------------------------------------------------------
+// getSBS96Handler
+// ------------------------------------------------------------------
+//
+// Endpoint: /sbs96?K=16&dataset=genome&groupBy=cancer_type[&cancerType=...&organ=...&donor_id=...]
+//
+// Aggregates the SBS96 spectrum of neomer-creating mutations per donor,
+// cancer type, organ or over everything (groupBy=all). Requires the
+// annotate-sbs96 step. Each group returns 96 counts in the order of
+// "channels", plus its total.
+//
+func getSBS96Handler(c *gin.Context) {
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    prefix, _ := neomerTablePrefix(dataset)
+    table := fmt.Sprintf("%s%d_sbs96", prefix, k)
+    cols, err := tableColumns(table)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(cols) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No %s table; run the annotate-sbs96 subcommand first", table)})
+        return
+    }
+    source, _ := neomerTableSourceSQL(dataset, table)
+
+    groupExpr := map[string]string{
+        "cancer_type": "Cancer_Type",
+        "organ":       "Organ",
+        "donor":       "Actual_Donor_ID",
+        "all":         "'all'",
+    }[c.DefaultQuery("groupBy", "cancer_type")]
+    if groupExpr == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'groupBy' must be one of donor, cancer_type, organ, all"})
+        return
+    }
+
+    var conds []string
+    var args []interface{}
+    for param, col := range map[string]string{"cancerType": "Cancer_Type", "organ": "Organ", "donor_id": "Actual_Donor_ID"} {
+        if v := c.Query(param); v != "" {
+            conds = append(conds, col+" = ?")
+            args = append(args, v)
+        }
+    }
+    where := ""
+    if len(conds) > 0 {
+        where = "WHERE " + strings.Join(conds, " AND ")
+    }
+
+    query := fmt.Sprintf(`
+        WITH src AS (%s)
+        SELECT
+            CAST(%s AS VARCHAR) AS grp,
+            sbs96,
+            COUNT(DISTINCT Actual_Donor_ID || '|' || mutation_key) AS mutations
+        FROM src
+        %s
+        GROUP BY grp, sbs96
+    `, source, groupExpr, where)
+    rows, err := db.Query(query, args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    channels := sbs96Channels()
+    channelIndex := make(map[string]int, len(channels))
+    for i, ch := range channels {
+        channelIndex[ch] = i
+    }
+    type spectrum struct {
+        Group  string  `json:"group"`
+        Total  int64   `json:"total"`
+        Counts []int64 `json:"counts"`
+    }
+    spectra := map[string]*spectrum{}
+    for rows.Next() {
+        var grp *string
+        var channel string
+        var n int64
+        if err := rows.Scan(&grp, &channel, &n); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        name := "Unknown"
+        if grp != nil {
+            name = *grp
+        }
+        i, ok := channelIndex[channel]
+        if !ok {
+            continue
+        }
+        sp, ok := spectra[name]
+        if !ok {
+            sp = &spectrum{Group: name, Counts: make([]int64, len(channels))}
+            spectra[name] = sp
+        }
+        sp.Counts[i] += n
+        sp.Total += n
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    result := make([]*spectrum, 0, len(spectra))
+    for _, sp := range spectra {
+        result = append(result, sp)
+    }
+    sort.Slice(result, func(i, j int) bool { return result[i].Group < result[j].Group })
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":        k,
+        "dataset":  dataset,
+        "channels": channels,
+        "spectra":  result,
+    })
+}
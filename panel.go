@@ -0,0 +1,267 @@
+package main
+
+import (
+    "container/heap"
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// getPanelDesignHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /panel_design?K=16&dataset=genome&cancerType=LIHC&size=10
+//                         &maxBackground=0.01&minCarriers=1&weighted=false
+//           (organ=Liver may be given instead of cancerType)
+//
+// Picks the smallest set of neomers covering the most donors of the
+// target cancer type or organ by greedy set cover over the donor–neomer
+// incidence. Candidates carried by more than maxBackground of the
+// non-target donors are discarded. With weighted=true each candidate's
+// gain is scaled by (1 - background frequency), favouring specific
+// neomers over slightly more sensitive but noisier ones.
+//
+type panelCandidate struct {
+    neomer     string
+    donors     []int
+    background int64
+    weight     float64
+    score      float64 // last evaluated score, an upper bound for lazy greedy
+    index      int
+}
+
+type panelHeap []*panelCandidate
+
+func (h panelHeap) Len() int { return len(h) }
+func (h panelHeap) Less(i, j int) bool {
+    if h[i].score != h[j].score {
+        return h[i].score > h[j].score
+    }
+    return h[i].neomer < h[j].neomer
+}
+func (h panelHeap) Swap(i, j int) {
+    h[i], h[j] = h[j], h[i]
+    h[i].index = i
+    h[j].index = j
+}
+func (h *panelHeap) Push(x interface{}) {
+    cand := x.(*panelCandidate)
+    cand.index = len(*h)
+    *h = append(*h, cand)
+}
+func (h *panelHeap) Pop() interface{} {
+    old := *h
+    cand := old[len(old)-1]
+    *h = old[:len(old)-1]
+    return cand
+}
+
+func getPanelDesignHandler(c *gin.Context) {
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    source, _ := neomerSourceSQL(dataset, k)
+
+    var targetCond string
+    var target string
+    switch {
+    case c.Query("cancerType") != "" && c.Query("organ") == "":
+        targetCond, target = "Cancer_Type = ?", c.Query("cancerType")
+    case c.Query("organ") != "" && c.Query("cancerType") == "":
+        targetCond, target = "Organ = ?", c.Query("organ")
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Exactly one of 'cancerType' or 'organ' is required"})
+        return
+    }
+
+    size := 10
+    if s, err := strconv.Atoi(c.Query("size")); err == nil && s > 0 && s <= 500 {
+        size = s
+    }
+    maxBackground := 1.0
+    if v := c.Query("maxBackground"); v != "" {
+        f, err := strconv.ParseFloat(v, 64)
+        if err != nil || f < 0 || f > 1 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'maxBackground' must be a fraction between 0 and 1"})
+            return
+        }
+        maxBackground = f
+    }
+    minCarriers := 1
+    if m, err := strconv.Atoi(c.Query("minCarriers")); err == nil && m > 0 {
+        minCarriers = m
+    }
+    weighted := c.Query("weighted") == "true"
+
+    // —— Target and background cohort sizes ——
+    var targetDonors, backgroundDonors int64
+    sizeQuery := fmt.Sprintf(`
+        WITH src AS (%s)
+        SELECT
+            COUNT(DISTINCT Actual_Donor_ID) FILTER (WHERE %[2]s),
+            COUNT(DISTINCT Actual_Donor_ID) FILTER (WHERE NOT (%[2]s))
+        FROM src
+    `, source, targetCond)
+    if err := db.QueryRow(sizeQuery, target, target).Scan(&targetDonors, &backgroundDonors); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cohort sizes: " + err.Error()})
+        return
+    }
+    if targetDonors == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No donors found for '%s'", target)})
+        return
+    }
+    maxBackgroundCarriers := int64(maxBackground * float64(backgroundDonors))
+
+    // —— Target incidence of the eligible candidates ——
+    incidenceQuery := fmt.Sprintf(`
+        WITH src AS (%s),
+        pairs AS (
+            SELECT DISTINCT nullomers_created, Actual_Donor_ID, (%s) AS is_target
+            FROM src
+        ),
+        stats AS (
+            SELECT
+                nullomers_created,
+                COUNT(*) FILTER (WHERE is_target)     AS target_carriers,
+                COUNT(*) FILTER (WHERE NOT is_target) AS background_carriers
+            FROM pairs
+            GROUP BY nullomers_created
+        )
+        SELECT p.nullomers_created, p.Actual_Donor_ID, s.background_carriers
+        FROM pairs p
+        JOIN stats s USING (nullomers_created)
+        WHERE p.is_target
+          AND s.target_carriers >= ?
+          AND s.background_carriers <= ?
+    `, source, targetCond)
+    rows, err := db.Query(incidenceQuery, target, minCarriers, maxBackgroundCarriers)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching incidence: " + err.Error()})
+        return
+    }
+    defer rows.Close()
+
+    donorIndex := map[string]int{}
+    candidates := map[string]*panelCandidate{}
+    for rows.Next() {
+        var neomer, donor string
+        var background int64
+        if err := rows.Scan(&neomer, &donor, &background); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning incidence row: " + err.Error()})
+            return
+        }
+        d, ok := donorIndex[donor]
+        if !ok {
+            d = len(donorIndex)
+            donorIndex[donor] = d
+        }
+        cand, ok := candidates[neomer]
+        if !ok {
+            cand = &panelCandidate{neomer: neomer, background: background, weight: 1}
+            if weighted && backgroundDonors > 0 {
+                cand.weight = 1 - float64(background)/float64(backgroundDonors)
+            }
+            candidates[neomer] = cand
+        }
+        cand.donors = append(cand.donors, d)
+    }
+    if err := rows.Err(); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating incidence: " + err.Error()})
+        return
+    }
+
+    // —— Lazy greedy set cover ——
+    h := make(panelHeap, 0, len(candidates))
+    for _, cand := range candidates {
+        cand.score = float64(len(cand.donors)) * cand.weight
+        heap.Push(&h, cand)
+    }
+    covered := make([]bool, len(donorIndex))
+    gain := func(cand *panelCandidate) int {
+        g := 0
+        for _, d := range cand.donors {
+            if !covered[d] {
+                g++
+            }
+        }
+        return g
+    }
+
+    type panelEntry struct {
+        Neomer              string  `json:"neomer"`
+        TargetCarriers      int     `json:"targetCarriers"`
+        NewlyCovered        int     `json:"newlyCovered"`
+        CumulativeCovered   int     `json:"cumulativeCovered"`
+        CumulativeCoverage  float64 `json:"cumulativeCoverage"`
+        OffTargetHits       int64   `json:"offTargetHits"`
+        BackgroundFrequency float64 `json:"backgroundFrequency"`
+    }
+    panel := []panelEntry{}
+    totalCovered := 0
+    for len(panel) < size && h.Len() > 0 {
+        best := heap.Pop(&h).(*panelCandidate)
+        g := gain(best)
+        if g == 0 {
+            continue
+        }
+        score := float64(g) * best.weight
+        if h.Len() > 0 && score < h[0].score {
+            // stale upper bound: re-insert with the fresh score
+            best.score = score
+            heap.Push(&h, best)
+            continue
+        }
+        for _, d := range best.donors {
+            covered[d] = true
+        }
+        totalCovered += g
+        entry := panelEntry{
+            Neomer:             best.neomer,
+            TargetCarriers:     len(best.donors),
+            NewlyCovered:       g,
+            CumulativeCovered:  totalCovered,
+            CumulativeCoverage: float64(totalCovered) / float64(targetDonors),
+            OffTargetHits:      best.background,
+        }
+        if backgroundDonors > 0 {
+            entry.BackgroundFrequency = float64(best.background) / float64(backgroundDonors)
+        }
+        panel = append(panel, entry)
+    }
+
+    // —— Off-target donors hit by the panel as a whole ——
+    var offTargetDonors int64
+    if len(panel) > 0 {
+        args := []interface{}{target}
+        for _, p := range panel {
+            args = append(args, p.Neomer)
+        }
+        offQuery := fmt.Sprintf(`
+            WITH src AS (%s)
+            SELECT COUNT(DISTINCT Actual_Donor_ID)
+            FROM src
+            WHERE NOT (%s) AND nullomers_created IN (%s)
+        `, source, targetCond, sqlPlaceholders(len(panel)))
+        if err := db.QueryRow(offQuery, args...).Scan(&offTargetDonors); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching off-target donors: " + err.Error()})
+            return
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "K":                k,
+        "dataset":          dataset,
+        "target":           target,
+        "targetDonors":     targetDonors,
+        "backgroundDonors": backgroundDonors,
+        "candidates":       len(candidates),
+        "panel":            panel,
+        "coverage":         float64(totalCovered) / float64(targetDonors),
+        "offTargetDonors":  offTargetDonors,
+    })
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+    "database/sql"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+const (
+    pivotMaxRows = 5000
+    pivotMaxCols = 500
+)
+
+// pivotLabel is one row or column of a pivot: its key, its label and
+// the dimension's native value, used for ordering. The key is the value
+// cast to text behind a "=" marker, or "null" for NULL, so it stays
+// unique where labels could collide.
+type pivotLabel struct {
+    Key   string
+    Label string
+    Value interface{}
+}
+
+// setPivotLabels labels values by their text and NULL as "Unknown", or
+// as "Unknown (NULL)" when a real "Unknown" value is present too.
+func setPivotLabels(labels []pivotLabel) {
+    nullLabel := "Unknown"
+    for _, l := range labels {
+        if l.Key == "=Unknown" {
+            nullLabel = "Unknown (NULL)"
+        }
+    }
+    for i, l := range labels {
+        if l.Key == "null" {
+            labels[i].Label = nullLabel
+        } else {
+            labels[i].Label = strings.TrimPrefix(l.Key, "=")
+        }
+    }
+}
+
+// sortPivotLabels orders labels by native value, numerically when both
+// values are numbers, with NULL ("Unknown") last.
+func sortPivotLabels(labels []pivotLabel) {
+    number := func(v interface{}) (float64, bool) {
+        switch x := v.(type) {
+        case int64:
+            return float64(x), true
+        case int32:
+            return float64(x), true
+        case float64:
+            return x, true
+        }
+        return 0, false
+    }
+    sort.Slice(labels, func(i, j int) bool {
+        a, b := labels[i].Value, labels[j].Value
+        if a == nil || b == nil {
+            return b == nil && a != nil
+        }
+        x, okA := number(a)
+        y, okB := number(b)
+        if okA && okB {
+            return x < y
+        }
+        return labels[i].Label < labels[j].Label
+    })
+}
+
+// sqlStringLiteral quotes s as a SQL string literal.
+func sqlStringLiteral(s string) string {
+    return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// ------------------------------------------------------------------
+// getPivotHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /pivot?dataset=genome&K=16&rows=Organ&cols=Hugo_Symbol
+//                 &measure=distinct_donors
+//                 [&filters=...&column=...&filterType=between&value=...&cohort=...]
+//           /pivot?rows=Cancer_Type&cols=K&minK=11&maxK=16&measure=count
+//
+// A dense rows x cols matrix of one measure (as in /stats: count,
+// distinct_donors, distinct_neomers, min:col, max:col, avg:col) over
+// the rows of the joined neomer/donor view matching the listing
+// endpoints' filters. Either dimension may be "K", in which case the
+// view spans every available K in [minK, maxK]; otherwise K selects
+// one table. Cells are computed with DuckDB PIVOT; row, column and
+// grand totals apply the measure to the whole row, column or view,
+// so they are also correct for distinct counts. Missing cells are 0
+// for counts and null for min/max/avg. NULL dimension values are
+// labelled "Unknown" (see setPivotLabels).
+//
+func getPivotHandler(c *gin.Context) {
+    rowDim, colDim := c.Query("rows"), c.Query("cols")
+    if rowDim == "" || colDim == "" || rowDim == colDim {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameters 'rows' and 'cols' must name two different dimensions"})
+        return
+    }
+    dataset := c.DefaultQuery("dataset", "genome")
+    prefix, err := neomerTablePrefix(dataset)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    // One K, or every K in range when K is a dimension
+    var ks []int
+    if rowDim == "K" || colDim == "K" {
+        available, err := availableKs(prefix)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        minK, errMin := strconv.Atoi(c.DefaultQuery("minK", "0"))
+        maxK, errMax := strconv.Atoi(c.DefaultQuery("maxK", "1000"))
+        if errMin != nil || errMax != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Parameters 'minK' and 'maxK' must be integers"})
+            return
+        }
+        for _, k := range available {
+            if k >= minK && k <= maxK {
+                ks = append(ks, k)
+            }
+        }
+        if len(ks) == 0 {
+            c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no %sK tables in range, available K: %v", prefix, available)})
+            return
+        }
+    } else {
+        _, k, err := datasetKParams(c)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        ks = []int{k}
+    }
+
+    var parts []string
+    types := map[string]string{"K": "INTEGER"}
+    for _, k := range ks {
+        source, kTypes, err := neomerDonorSourceSQL(dataset, k)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        parts = append(parts, fmt.Sprintf("SELECT %d AS K, * FROM (%s)", k, source))
+        for col, t := range kTypes {
+            types[col] = t
+        }
+    }
+    base := strings.Join(parts, " UNION ALL BY NAME ")
+
+    for _, dim := range []string{rowDim, colDim} {
+        if types[dim] == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown dimension '%s'", dim)})
+            return
+        }
+    }
+    measureSpec := c.DefaultQuery("measure", "count")
+    if strings.Contains(measureSpec, ",") {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'measure' takes a single measure"})
+        return
+    }
+    measures, err := parseStatsMeasures(measureSpec, types)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    measure := measures[0]
+    isCount := measure.Name == "count" || strings.HasPrefix(measure.Name, "distinct_")
+
+    conds, args, err := listingFilterConds(c, dataset, ks[0])
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    cohortWhere, cohortArgs, ok := cohortDonorClause(c, dataset, "Actual_Donor_ID")
+    if !ok {
+        return
+    }
+    if cohortWhere != "" {
+        conds = append(conds, cohortWhere)
+        args = append(args, cohortArgs...)
+    }
+    whereSQL := ""
+    if len(conds) > 0 {
+        whereSQL = "WHERE " + strings.Join(conds, " AND ")
+    }
+    view := fmt.Sprintf(`
+        WITH v AS (
+            SELECT *,
+                "%[1]s" AS row_value, COALESCE('=' || CAST("%[1]s" AS VARCHAR), 'null') AS row_key,
+                "%[2]s" AS col_value, COALESCE('=' || CAST("%[2]s" AS VARCHAR), 'null') AS col_key
+            FROM (%[3]s)
+            %[4]s
+        )
+    `, rowDim, colDim, base, whereSQL)
+
+    // Labels and totals in one pass
+    rows, err := db.Query(fmt.Sprintf(`
+        %s
+        SELECT GROUPING(row_key), GROUPING(col_key),
+               ANY_VALUE(row_value), row_key, ANY_VALUE(col_value), col_key,
+               %s
+        FROM v
+        GROUP BY GROUPING SETS ((row_key), (col_key), ())
+    `, view, measure.SQL), args...)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var rowLabels, colLabels []pivotLabel
+    rowTotals, colTotals := map[string]*float64{}, map[string]*float64{}
+    var grandTotal *float64
+    for rows.Next() {
+        var rowGrouping, colGrouping int64
+        var rowValue, colValue interface{}
+        var rowKey, colKey sql.NullString
+        var total sql.NullFloat64
+        if err := rows.Scan(&rowGrouping, &colGrouping, &rowValue, &rowKey, &colValue, &colKey, &total); err != nil {
+            rows.Close()
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        var t *float64
+        if total.Valid {
+            t = &total.Float64
+        }
+        switch {
+        case rowGrouping == 0:
+            rowLabels = append(rowLabels, pivotLabel{Key: rowKey.String, Value: rowValue})
+            rowTotals[rowKey.String] = t
+        case colGrouping == 0:
+            colLabels = append(colLabels, pivotLabel{Key: colKey.String, Value: colValue})
+            colTotals[colKey.String] = t
+        default:
+            grandTotal = t
+        }
+    }
+    err = rows.Err()
+    rows.Close()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(rowLabels) > pivotMaxRows || len(colLabels) > pivotMaxCols {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Pivot too large (%d x %d, max %d x %d); add filters or swap dimensions",
+            len(rowLabels), len(colLabels), pivotMaxRows, pivotMaxCols)})
+        return
+    }
+    setPivotLabels(rowLabels)
+    setPivotLabels(colLabels)
+    sortPivotLabels(rowLabels)
+    sortPivotLabels(colLabels)
+
+    // Cells via PIVOT on the known column labels
+    matrix := make([][]*float64, len(rowLabels))
+    rowIndex := make(map[string]int, len(rowLabels))
+    for i, l := range rowLabels {
+        rowIndex[l.Key] = i
+        matrix[i] = make([]*float64, len(colLabels))
+    }
+    if len(colLabels) > 0 {
+        in := make([]string, len(colLabels))
+        for i, l := range colLabels {
+            in[i] = sqlStringLiteral(l.Key)
+        }
+        pivotRows, err := db.Query(fmt.Sprintf(`
+            %s
+            PIVOT v ON col_key IN (%s) USING %s GROUP BY row_key
+        `, view, strings.Join(in, ", "), measure.SQL), args...)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        defer pivotRows.Close()
+        for pivotRows.Next() {
+            var key string
+            cells := make([]sql.NullFloat64, len(colLabels))
+            ptrs := []interface{}{&key}
+            for i := range cells {
+                ptrs = append(ptrs, &cells[i])
+            }
+            if err := pivotRows.Scan(ptrs...); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            i, ok := rowIndex[key]
+            if !ok {
+                continue
+            }
+            for j, cell := range cells {
+                if cell.Valid {
+                    v := cell.Float64
+                    matrix[i][j] = &v
+                }
+            }
+        }
+        if err := pivotRows.Err(); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+    if isCount {
+        for _, row := range matrix {
+            for j := range row {
+                if row[j] == nil {
+                    row[j] = new(float64)
+                }
+            }
+        }
+    }
+
+    labels := func(ls []pivotLabel, totals map[string]*float64) ([]string, []*float64) {
+        names := make([]string, len(ls))
+        sums := make([]*float64, len(ls))
+        for i, l := range ls {
+            names[i], sums[i] = l.Label, totals[l.Key]
+        }
+        return names, sums
+    }
+    rowNames, rowSums := labels(rowLabels, rowTotals)
+    colNames, colSums := labels(colLabels, colTotals)
+
+    c.JSON(http.StatusOK, gin.H{
+        "dataset":    dataset,
+        "ks":         ks,
+        "rows":       rowDim,
+        "cols":       colDim,
+        "measure":    measure.Name,
+        "rowLabels":  rowNames,
+        "colLabels":  colNames,
+        "matrix":     matrix,
+        "rowTotals":  rowSums,
+        "colTotals":  colSums,
+        "grandTotal": grandTotal,
+    })
+}
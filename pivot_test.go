@@ -0,0 +1,44 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestPivotLabels(t *testing.T) {
+    cases := []struct {
+        name string
+        keys []string
+        want string
+    }{
+        {"null alone", []string{"=Liver", "null", "=Breast"}, "Breast, Liver, Unknown"},
+        {"null and Unknown", []string{"null", "=Unknown", "=Liver"}, "Liver, Unknown, Unknown (NULL)"},
+        {"Unknown alone", []string{"=Unknown", "=Liver"}, "Liver, Unknown"},
+    }
+    for _, tc := range cases {
+        labels := make([]pivotLabel, len(tc.keys))
+        for i, k := range tc.keys {
+            labels[i].Key = k
+            if k != "null" {
+                labels[i].Value = strings.TrimPrefix(k, "=")
+            }
+        }
+        setPivotLabels(labels)
+        sortPivotLabels(labels)
+        var got []string
+        for _, l := range labels {
+            got = append(got, l.Label)
+        }
+        if strings.Join(got, ", ") != tc.want {
+            t.Errorf("%s: got %v, want %s", tc.name, got, tc.want)
+        }
+    }
+
+    // Numbers sort numerically, not by their text
+    labels := []pivotLabel{{Key: "=16", Value: int64(16)}, {Key: "=9", Value: int64(9)}, {Key: "null"}, {Key: "=11", Value: int64(11)}}
+    setPivotLabels(labels)
+    sortPivotLabels(labels)
+    if got := []string{labels[0].Label, labels[1].Label, labels[2].Label, labels[3].Label}; strings.Join(got, " ") != "9 11 16 Unknown" {
+        t.Errorf("got %v, want 9 11 16 Unknown", got)
+    }
+}
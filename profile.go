@@ -0,0 +1,349 @@
+package main
+
+import (
+    "database/sql"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// getPatientProfileHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /patient_profile?donor_id=DO1234[&dataset=genome|exome]
+//                           [&K=16&top_n=10&match=patient]
+//
+// Everything known about one donor in a single response: the clinical
+// row (donor_data or exome_donor_data), cancer type and organ, neomer
+// rows and distinct neomers at every available K, the donor's top
+// neomers at K (default: the smallest K where the donor has any) with
+// their cohort recurrence, TCGA survival records, and the donor's
+// records in the other dataset linked through Tumor_Sample_Barcode
+// (see barcodeLinkSQL). Neomers are taken over all of the donor's
+// samples, i.e. every mapping row of its Actual_Donor_ID. Without
+// "dataset" the donor ID is looked up in the genome mapping first,
+// then in the exome mapping.
+//
+func getPatientProfileHandler(c *gin.Context) {
+    donorID := c.Query("donor_id")
+    if donorID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing donor_id"})
+        return
+    }
+    topN := 10
+    if n, err := strconv.Atoi(c.Query("top_n")); err == nil && n > 0 && n <= 1000 {
+        topN = n
+    }
+    match := c.DefaultQuery("match", "patient")
+    if _, err := barcodeLinkSQL("m", match); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    // Resolve the donor's internal ID and dataset
+    candidates := []string{"genome", "exome"}
+    if d := c.Query("dataset"); d != "" {
+        if d != "genome" && d != "exome" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown dataset '%s', expected 'genome' or 'exome'", d)})
+            return
+        }
+        candidates = []string{d}
+    }
+    var dataset string
+    barcodes := []string{}
+    for _, d := range candidates {
+        tables, _ := datasetDonorTables(d)
+        rows, err := db.Query(fmt.Sprintf(`
+            SELECT DISTINCT Tumor_Sample_Barcode FROM %s WHERE Actual_Donor_ID = ? ORDER BY 1
+        `, tables.Mapping), donorID)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        for rows.Next() {
+            var barcode sql.NullString
+            if err := rows.Scan(&barcode); err != nil {
+                rows.Close()
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            dataset = d
+            if barcode.Valid {
+                barcodes = append(barcodes, barcode.String)
+            }
+        }
+        err = rows.Err()
+        rows.Close()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        if dataset != "" {
+            break
+        }
+    }
+    if dataset == "" {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Donor '%s' not found", donorID)})
+        return
+    }
+    tables, _ := datasetDonorTables(dataset)
+    prefix, _ := neomerTablePrefix(dataset)
+    samples := fmt.Sprintf(`CAST("Donor_ID" AS INT) IN (SELECT Donor_ID FROM %s WHERE Actual_Donor_ID = ?)`, tables.Mapping)
+
+    // Clinical metadata
+    var clinical map[string]interface{}
+    headers, data, err := queryTable(fmt.Sprintf(`SELECT * FROM %s WHERE %s = ? LIMIT 1`, tables.Clinical, tables.ClinicalKey), donorID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(data) > 0 {
+        clinical = make(map[string]interface{}, len(headers))
+        for i, h := range headers {
+            clinical[h] = data[0][i]
+        }
+    }
+
+    // Neomer counts at every K, in one query
+    ks, err := availableKs(prefix)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    type kCount struct {
+        K               int   `json:"K"`
+        Rows            int64 `json:"rows"`
+        DistinctNeomers int64 `json:"distinctNeomers"`
+    }
+    counts := make([]kCount, 0, len(ks))
+    var cancerType, organ sql.NullString
+    if len(ks) > 0 {
+        projectCol := "Project_Code"
+        if dataset == "exome" {
+            projectCol = "NULL"
+        }
+        var parts []string
+        var args []interface{}
+        for _, k := range ks {
+            parts = append(parts, fmt.Sprintf(`SELECT %d AS K, nullomers_created, %s AS Project_Code FROM %s%d WHERE %s`, k, projectCol, prefix, k, samples))
+            args = append(args, donorID)
+        }
+        rows, err := db.Query(fmt.Sprintf(`
+            SELECT K, COUNT(*), COUNT(DISTINCT nullomers_created), ANY_VALUE(Project_Code)
+            FROM (%s)
+            GROUP BY K
+        `, strings.Join(parts, " UNION ALL ")), args...)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        byK := map[int]kCount{}
+        var projectCode sql.NullString
+        for rows.Next() {
+            var kc kCount
+            var pc sql.NullString
+            if err := rows.Scan(&kc.K, &kc.Rows, &kc.DistinctNeomers, &pc); err != nil {
+                rows.Close()
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            byK[kc.K] = kc
+            if pc.Valid {
+                projectCode = pc
+            }
+        }
+        err = rows.Err()
+        rows.Close()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        for _, k := range ks {
+            counts = append(counts, kCount{K: k, Rows: byK[k].Rows, DistinctNeomers: byK[k].DistinctNeomers})
+        }
+
+        // The genome dataset classifies donors through Project_Code, the
+        // exome dataset in exome_donor_data; no row leaves them unknown
+        if dataset == "genome" {
+            if projectCode.Valid {
+                err = db.QueryRow(`SELECT Cancer_Type, Organ FROM cancer_type_details WHERE Project_Code = ?`, projectCode.String).Scan(&cancerType, &organ)
+            }
+        } else {
+            err = db.QueryRow(`SELECT Cancer_Type, Organ FROM exome_donor_data WHERE bcr_patient_barcode = ?`, donorID).Scan(&cancerType, &organ)
+        }
+        if err != nil && err != sql.ErrNoRows {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    // Top neomers at K
+    topK := 0
+    if k, err := strconv.Atoi(c.Query("K")); err == nil {
+        for _, kc := range counts {
+            if kc.K == k {
+                topK = k
+            }
+        }
+        if topK == 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("no %s%d table, available K: %v", prefix, k, ks)})
+            return
+        }
+    } else {
+        for _, kc := range counts {
+            if kc.Rows > 0 {
+                topK = kc.K
+                break
+            }
+        }
+    }
+    type topNeomer struct {
+        Neomer       string `json:"neomer"`
+        Count        int64  `json:"count"`
+        CohortDonors int64  `json:"cohortDonors"`
+    }
+    topNeomers := []topNeomer{}
+    if topK > 0 {
+        rows, err := db.Query(fmt.Sprintf(`
+            WITH mine AS (
+                SELECT nullomers_created, COUNT(*) AS cnt
+                FROM %[1]s
+                WHERE %[2]s
+                GROUP BY nullomers_created
+            )
+            SELECT m.nullomers_created, m.cnt, COUNT(DISTINCT d.Actual_Donor_ID) AS cohort_donors
+            FROM mine m
+            JOIN %[1]s n USING (nullomers_created)
+            JOIN %[3]s d ON d.Donor_ID = CAST(n."Donor_ID" AS INT)
+            GROUP BY m.nullomers_created, m.cnt
+            ORDER BY m.cnt DESC, cohort_donors DESC, m.nullomers_created
+            LIMIT ?
+        `, fmt.Sprintf("%s%d", prefix, topK), samples, tables.Mapping), donorID, topN)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        for rows.Next() {
+            var t topNeomer
+            if err := rows.Scan(&t.Neomer, &t.Count, &t.CohortDonors); err != nil {
+                rows.Close()
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            topNeomers = append(topNeomers, t)
+        }
+        err = rows.Err()
+        rows.Close()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    // Matched records in the other dataset
+    other := "exome"
+    if dataset == "exome" {
+        other = "genome"
+    }
+    otherTables, _ := datasetDonorTables(other)
+    thisKey, _ := barcodeLinkSQL("m", match)
+    otherKey, _ := barcodeLinkSQL("o", match)
+    type matchedRecord struct {
+        Dataset            string `json:"dataset"`
+        DonorID            string `json:"donorId"`
+        TumorSampleBarcode string `json:"tumorSampleBarcode"`
+        Profile            string `json:"profile"`
+    }
+    matched := []matchedRecord{}
+    rows, err := db.Query(fmt.Sprintf(`
+        SELECT DISTINCT o.Actual_Donor_ID, COALESCE(o.Tumor_Sample_Barcode, '')
+        FROM %s m
+        JOIN %s o ON %s = %s
+        WHERE m.Actual_Donor_ID = ?
+        ORDER BY 1
+    `, tables.Mapping, otherTables.Mapping, thisKey, otherKey), donorID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    for rows.Next() {
+        r := matchedRecord{Dataset: other}
+        if err := rows.Scan(&r.DonorID, &r.TumorSampleBarcode); err != nil {
+            rows.Close()
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        r.Profile = "/patient_profile?dataset=" + other + "&donor_id=" + url.QueryEscape(r.DonorID)
+        matched = append(matched, r)
+    }
+    err = rows.Err()
+    rows.Close()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    // Survival records, keyed by TCGA patient barcode
+    survival := []map[string]interface{}{}
+    patients := map[string]bool{}
+    if dataset == "exome" {
+        patients[donorID] = true
+    }
+    for _, m := range matched {
+        if m.Dataset == "exome" {
+            patients[m.DonorID] = true
+        }
+    }
+    for _, barcode := range barcodes {
+        if strings.HasPrefix(barcode, "TCGA-") && len(barcode) >= 12 {
+            patients[barcode[:12]] = true
+        }
+    }
+    if survivalCols, err := tableColumns("tcga_survival_data"); err == nil && survivalCols["bcr_patient_barcode"] && len(patients) > 0 {
+        var args []interface{}
+        for p := range patients {
+            args = append(args, p)
+        }
+        headers, data, err := queryTable(fmt.Sprintf(`
+            SELECT * FROM tcga_survival_data WHERE bcr_patient_barcode IN (%s)
+        `, sqlPlaceholders(len(args))), args...)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        for _, row := range data {
+            rec := make(map[string]interface{}, len(headers))
+            for i, h := range headers {
+                rec[h] = row[i]
+            }
+            survival = append(survival, rec)
+        }
+    }
+
+    // tumorSampleBarcode keeps the first barcode for existing clients
+    firstBarcode := ""
+    if len(barcodes) > 0 {
+        firstBarcode = barcodes[0]
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "donorId":             donorID,
+        "dataset":             dataset,
+        "tumorSampleBarcode":  firstBarcode,
+        "tumorSampleBarcodes": barcodes,
+        "cancerType":          cancerType.String,
+        "organ":               organ.String,
+        "clinical":            clinical,
+        "neomerCounts":        counts,
+        "topNeomers": gin.H{
+            "K":       topK,
+            "neomers": topNeomers,
+        },
+        "survival":       survival,
+        "matchedRecords": matched,
+    })
+}
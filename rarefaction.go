@@ -0,0 +1,260 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+    "net/http"
+    "sort"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// getRarefactionHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /rarefaction?K=16&dataset=genome[&cancerType=LIHC|&organ=Liver]
+//                       &method=analytic&points=50&iterations=100&seed=1
+//
+// Expected number of distinct neomers as a function of the number of
+// sampled donors, for one cancer type, organ, or the whole cohort.
+//
+// method=analytic uses sample-based (incidence) rarefaction: with T
+// donors and Q_k neomers seen in exactly k donors,
+//     S(m) = sum_k Q_k * (1 - C(T-k, m) / C(T, m))
+// and the unconditional variance of Colwell et al. (2012),
+//     var(m) = sum_k (1 - a_km)^2 Q_k - S(m)^2 / S_est
+// with a_km = C(T-k, m) / C(T, m) and S_est the Chao2 richness estimate.
+// Bands are S(m) ± 1.96 sd.
+//
+// method=subsample adds donors in random order `iterations` times
+// (seeded) and reports the mean with 2.5% / 97.5% percentile bands.
+//
+func getRarefactionHandler(c *gin.Context) {
+    dataset, k, err := datasetKParams(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    source, _ := neomerSourceSQL(dataset, k)
+
+    where := ""
+    var args []interface{}
+    group := "all donors"
+    switch {
+    case c.Query("cancerType") != "" && c.Query("organ") != "":
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Use at most one of 'cancerType' or 'organ'"})
+        return
+    case c.Query("cancerType") != "":
+        where, group = "WHERE Cancer_Type = ?", c.Query("cancerType")
+        args = append(args, group)
+    case c.Query("organ") != "":
+        where, group = "WHERE Organ = ?", c.Query("organ")
+        args = append(args, group)
+    }
+
+    method := c.DefaultQuery("method", "analytic")
+    if method != "analytic" && method != "subsample" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'method' must be 'analytic' or 'subsample'"})
+        return
+    }
+    points := 50
+    if p, err := strconv.Atoi(c.Query("points")); err == nil && p >= 2 && p <= 1000 {
+        points = p
+    }
+    iterations := 100
+    if it, err := strconv.Atoi(c.Query("iterations")); err == nil && it > 0 && it <= 10000 {
+        iterations = it
+    }
+    seed := int64(1)
+    if s, err := strconv.ParseInt(c.Query("seed"), 10, 64); err == nil {
+        seed = s
+    }
+
+    type curvePoint struct {
+        Donors   int     `json:"donors"`
+        Expected float64 `json:"expected"`
+        Lower    float64 `json:"lower"`
+        Upper    float64 `json:"upper"`
+    }
+    var curve []curvePoint
+    var totalDonors int
+    var observed int64
+
+    if method == "analytic" {
+        // Incidence frequency counts: Q_k neomers seen in exactly k donors
+        query := fmt.Sprintf(`
+            WITH src AS (%s),
+            per_neomer AS (
+                SELECT nullomers_created, COUNT(DISTINCT Actual_Donor_ID) AS donor_count
+                FROM src
+                %s
+                GROUP BY nullomers_created
+            )
+            SELECT donor_count, COUNT(*) FROM per_neomer GROUP BY donor_count
+        `, source, where)
+        rows, err := db.Query(query, args...)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        defer rows.Close()
+        freq := map[int64]int64{}
+        for rows.Next() {
+            var donorCount, num int64
+            if err := rows.Scan(&donorCount, &num); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            freq[donorCount] = num
+            observed += num
+        }
+        if err := rows.Err(); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+
+        countQuery := fmt.Sprintf(`
+            WITH src AS (%s)
+            SELECT COUNT(DISTINCT Actual_Donor_ID) FROM src %s
+        `, source, where)
+        if err := db.QueryRow(countQuery, args...).Scan(&totalDonors); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+
+        T := int64(totalDonors)
+        chao2 := float64(observed)
+        if T > 1 {
+            q1, q2 := float64(freq[1]), float64(freq[2])
+            factor := float64(T-1) / float64(T)
+            if q2 > 0 {
+                chao2 += factor * q1 * q1 / (2 * q2)
+            } else {
+                chao2 += factor * q1 * (q1 - 1) / 2
+            }
+        }
+        for _, m := range rarefactionSteps(totalDonors, points) {
+            var s, v float64
+            denom := logChoose(T, int64(m))
+            for kk, q := range freq {
+                a := math.Exp(logChoose(T-kk, int64(m)) - denom)
+                s += float64(q) * (1 - a)
+                v += (1 - a) * (1 - a) * float64(q)
+            }
+            if chao2 > 0 {
+                v -= s * s / chao2
+            }
+            sd := math.Sqrt(math.Max(v, 0))
+            curve = append(curve, curvePoint{m, s, math.Max(s-1.96*sd, 0), s + 1.96*sd})
+        }
+    } else {
+        // Per-donor neomer lists
+        query := fmt.Sprintf(`
+            WITH src AS (%s)
+            SELECT DISTINCT Actual_Donor_ID, nullomers_created FROM src %s
+        `, source, where)
+        rows, err := db.Query(query, args...)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        defer rows.Close()
+        donorIndex := map[string]int{}
+        neomerIndex := map[string]int{}
+        var incidence [][]int
+        for rows.Next() {
+            var donor, neomer string
+            if err := rows.Scan(&donor, &neomer); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            d, ok := donorIndex[donor]
+            if !ok {
+                d = len(incidence)
+                donorIndex[donor] = d
+                incidence = append(incidence, nil)
+            }
+            ni, ok := neomerIndex[neomer]
+            if !ok {
+                ni = len(neomerIndex)
+                neomerIndex[neomer] = ni
+            }
+            incidence[d] = append(incidence[d], ni)
+        }
+        if err := rows.Err(); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        totalDonors = len(incidence)
+        observed = int64(len(neomerIndex))
+
+        steps := rarefactionSteps(totalDonors, points)
+        samples := make([][]float64, len(steps))
+        rng := rand.New(rand.NewSource(seed))
+        seen := make([]int, len(neomerIndex)) // iteration stamp per neomer
+        for it := 1; it <= iterations; it++ {
+            distinct := 0
+            si := 0
+            for i, d := range rng.Perm(totalDonors) {
+                for _, ni := range incidence[d] {
+                    if seen[ni] != it {
+                        seen[ni] = it
+                        distinct++
+                    }
+                }
+                for si < len(steps) && steps[si] == i+1 {
+                    samples[si] = append(samples[si], float64(distinct))
+                    si++
+                }
+            }
+        }
+        for si, m := range steps {
+            vals := samples[si]
+            sort.Float64s(vals)
+            mean := 0.0
+            for _, v := range vals {
+                mean += v
+            }
+            mean /= float64(len(vals))
+            curve = append(curve, curvePoint{m, mean, percentile(vals, 0.025), percentile(vals, 0.975)})
+        }
+    }
+
+    if totalDonors == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No donors found for '%s'", group)})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "K":               k,
+        "dataset":         dataset,
+        "group":           group,
+        "method":          method,
+        "totalDonors":     totalDonors,
+        "observedNeomers": observed,
+        "curve":           curve,
+    })
+}
+
+// rarefactionSteps returns up to `points` sample sizes from 1 to n,
+// evenly spaced and always including 1 and n.
+func rarefactionSteps(n, points int) []int {
+    if n <= 0 {
+        return nil
+    }
+    var steps []int
+    last := 0
+    for i := 0; i < points; i++ {
+        m := 1
+        if points > 1 {
+            m = 1 + int(math.Round(float64(i)*float64(n-1)/float64(points-1)))
+        }
+        if m > last {
+            steps = append(steps, m)
+            last = m
+        }
+    }
+    return steps
+}
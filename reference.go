@@ -0,0 +1,523 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Reference genome index
+// ------------------------------------------------------------------
+//
+// Neomers are supposed to be absent from the reference genome. When
+// NEOMERS_REFERENCE_FILE points at a local FASTA (.fa/.fasta/.fna) or
+// UCSC 2bit (.2bit) file, it is loaded at startup in the background
+// into memory at one byte per base (about 3.1GB for GRCh38), together
+// with a presence bitset of every k-mer for K up to
+// NEOMERS_REFERENCE_INDEX_MAX_K (default 13, at most 16; a K=16 bitset
+// takes 512MB). Sequences are checked against the bitset
+// first, longer ones through their windows of the largest indexed K;
+// anything that may be present is located by scanning the chromosomes
+// so that occurrences can be reported with coordinates. Scans are
+// capped at referenceMaxScans per request.
+
+const (
+    referenceIndexMinK = 11
+    referenceMaxScans  = 100
+)
+
+type referenceChrom struct {
+    Name string
+    Seq  []byte // upper-case A/C/G/T/N
+}
+
+type referenceIndex struct {
+    Path    string
+    Chroms  []referenceChrom
+    MaxK    int
+    Bitsets map[int][]uint64 // K -> 4^K presence bits, forward strand
+}
+
+var (
+    referenceMu     sync.RWMutex
+    reference       *referenceIndex
+    referenceErr    error
+    referenceStatus = "not configured"
+)
+
+func getReferencePath() string {
+    return os.Getenv("NEOMERS_REFERENCE_FILE")
+}
+
+func getReferenceIndexMaxK() int {
+    maxK := 13
+    if v := os.Getenv("NEOMERS_REFERENCE_INDEX_MAX_K"); v != "" {
+        if k, err := strconv.Atoi(v); err == nil {
+            maxK = k
+        }
+    }
+    if maxK > 16 {
+        maxK = 16
+    }
+    return maxK
+}
+
+// initReference loads the configured reference. It is meant to run in
+// its own goroutine; the verification endpoint answers 503 until done.
+func initReference(path string) {
+    referenceMu.Lock()
+    referenceStatus = "loading"
+    referenceMu.Unlock()
+
+    start := time.Now()
+    idx, err := loadReference(path, getReferenceIndexMaxK())
+
+    referenceMu.Lock()
+    defer referenceMu.Unlock()
+    if err != nil {
+        referenceErr = err
+        referenceStatus = "unavailable"
+        log.Printf("Reference unavailable: %v", err)
+        return
+    }
+    reference = idx
+    referenceStatus = "available"
+    log.Printf("Reference %s loaded: %d sequences, k-mer index K=%d..%d (%s)",
+        path, len(idx.Chroms), referenceIndexMinK, idx.MaxK, time.Since(start).Round(time.Second))
+}
+
+func loadReference(path string, maxK int) (*referenceIndex, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open reference %s: %w", path, err)
+    }
+    defer f.Close()
+
+    var chroms []referenceChrom
+    if strings.HasSuffix(strings.ToLower(path), ".2bit") {
+        chroms, err = readTwoBit(f)
+    } else {
+        chroms, err = readFasta(f)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read reference %s: %w", path, err)
+    }
+    if len(chroms) == 0 {
+        return nil, fmt.Errorf("reference %s contains no sequences", path)
+    }
+
+    idx := &referenceIndex{Path: path, Chroms: chroms, MaxK: maxK, Bitsets: map[int][]uint64{}}
+    idx.buildBitsets()
+    return idx, nil
+}
+
+// readFasta reads every record of a (possibly multi-line) FASTA file.
+func readFasta(r io.Reader) ([]referenceChrom, error) {
+    var chroms []referenceChrom
+    var cur *bytes.Buffer
+    var name string
+    flush := func() {
+        if cur != nil {
+            chroms = append(chroms, referenceChrom{Name: name, Seq: bytes.ToUpper(cur.Bytes())})
+        }
+    }
+
+    sc := bufio.NewScanner(r)
+    sc.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+    for sc.Scan() {
+        line := bytes.TrimSpace(sc.Bytes())
+        if len(line) == 0 {
+            continue
+        }
+        if line[0] == '>' {
+            flush()
+            fields := strings.Fields(string(line[1:]))
+            name = ""
+            if len(fields) > 0 {
+                name = fields[0]
+            }
+            cur = &bytes.Buffer{}
+            continue
+        }
+        if cur == nil {
+            return nil, fmt.Errorf("sequence data before first FASTA header")
+        }
+        cur.Write(line)
+    }
+    if err := sc.Err(); err != nil {
+        return nil, err
+    }
+    flush()
+    return chroms, nil
+}
+
+// readTwoBit reads a UCSC .2bit file (version 0 or 1). Soft-masking is
+// ignored; N blocks are restored as 'N'.
+func readTwoBit(r io.ReadSeeker) ([]referenceChrom, error) {
+    const signature = 0x1A412743
+
+    var sig [4]byte
+    if _, err := io.ReadFull(r, sig[:]); err != nil {
+        return nil, err
+    }
+    var order binary.ByteOrder
+    switch {
+    case binary.LittleEndian.Uint32(sig[:]) == signature:
+        order = binary.LittleEndian
+    case binary.BigEndian.Uint32(sig[:]) == signature:
+        order = binary.BigEndian
+    default:
+        return nil, fmt.Errorf("not a 2bit file")
+    }
+    var header [3]uint32 // version, sequence count, reserved
+    if err := binary.Read(r, order, &header); err != nil {
+        return nil, err
+    }
+    version, seqCount := header[0], header[1]
+    if version > 1 {
+        return nil, fmt.Errorf("unsupported 2bit version %d", version)
+    }
+
+    type entry struct {
+        name   string
+        offset uint64
+    }
+    entries := make([]entry, 0, seqCount)
+    for i := uint32(0); i < seqCount; i++ {
+        var nameLen [1]byte
+        if _, err := io.ReadFull(r, nameLen[:]); err != nil {
+            return nil, err
+        }
+        name := make([]byte, nameLen[0])
+        if _, err := io.ReadFull(r, name); err != nil {
+            return nil, err
+        }
+        var off uint64
+        if version == 1 {
+            if err := binary.Read(r, order, &off); err != nil {
+                return nil, err
+            }
+        } else {
+            var off32 uint32
+            if err := binary.Read(r, order, &off32); err != nil {
+                return nil, err
+            }
+            off = uint64(off32)
+        }
+        entries = append(entries, entry{string(name), off})
+    }
+
+    readU32s := func(n uint32) ([]uint32, error) {
+        v := make([]uint32, n)
+        return v, binary.Read(r, order, v)
+    }
+
+    const bases = "TCAG"
+    chroms := make([]referenceChrom, 0, len(entries))
+    for _, e := range entries {
+        if _, err := r.Seek(int64(e.offset), io.SeekStart); err != nil {
+            return nil, err
+        }
+        var dnaSize, nBlockCount uint32
+        if err := binary.Read(r, order, &dnaSize); err != nil {
+            return nil, err
+        }
+        if err := binary.Read(r, order, &nBlockCount); err != nil {
+            return nil, err
+        }
+        nStarts, err := readU32s(nBlockCount)
+        if err != nil {
+            return nil, err
+        }
+        nSizes, err := readU32s(nBlockCount)
+        if err != nil {
+            return nil, err
+        }
+        var maskBlockCount uint32
+        if err := binary.Read(r, order, &maskBlockCount); err != nil {
+            return nil, err
+        }
+        // skip mask starts, mask sizes and the reserved word
+        if _, err := r.Seek(int64(maskBlockCount)*8+4, io.SeekCurrent); err != nil {
+            return nil, err
+        }
+
+        packed := make([]byte, (dnaSize+3)/4)
+        if _, err := io.ReadFull(r, packed); err != nil {
+            return nil, err
+        }
+        seq := make([]byte, dnaSize)
+        for i := uint32(0); i < dnaSize; i++ {
+            shift := 6 - 2*(i%4)
+            seq[i] = bases[(packed[i/4]>>shift)&3]
+        }
+        for b := range nStarts {
+            end := nStarts[b] + nSizes[b]
+            if end > dnaSize {
+                end = dnaSize
+            }
+            for i := nStarts[b]; i < end; i++ {
+                seq[i] = 'N'
+            }
+        }
+        chroms = append(chroms, referenceChrom{Name: e.name, Seq: seq})
+    }
+    return chroms, nil
+}
+
+func baseCode(b byte) (uint64, bool) {
+    switch b {
+    case 'A':
+        return 0, true
+    case 'C':
+        return 1, true
+    case 'G':
+        return 2, true
+    case 'T':
+        return 3, true
+    }
+    return 0, false
+}
+
+// encodeKmer packs an A/C/G/T k-mer into 2 bits per base.
+func encodeKmer(s string) (uint64, bool) {
+    var v uint64
+    for i := 0; i < len(s); i++ {
+        code, ok := baseCode(s[i])
+        if !ok {
+            return 0, false
+        }
+        v = v<<2 | code
+    }
+    return v, true
+}
+
+func (idx *referenceIndex) buildBitsets() {
+    if idx.MaxK < referenceIndexMinK {
+        return
+    }
+    for k := referenceIndexMinK; k <= idx.MaxK; k++ {
+        idx.Bitsets[k] = make([]uint64, (uint64(1)<<(2*uint(k)))/64)
+    }
+    mask := uint64(1)<<(2*uint(idx.MaxK)) - 1
+    for _, ch := range idx.Chroms {
+        var v uint64
+        run := 0
+        for _, b := range ch.Seq {
+            code, ok := baseCode(b)
+            if !ok {
+                run = 0
+                v = 0
+                continue
+            }
+            v = (v<<2 | code) & mask
+            run++
+            for k := referenceIndexMinK; k <= idx.MaxK && k <= run; k++ {
+                kmer := v & (uint64(1)<<(2*uint(k)) - 1)
+                idx.Bitsets[k][kmer/64] |= 1 << (kmer % 64)
+            }
+        }
+    }
+}
+
+// mayContain reports false only when s is known to be absent from the
+// forward strand of the reference: s, or one of its windows of the
+// largest indexed K, is missing from the bitset. Windows containing N
+// are not indexed and prove nothing.
+func (idx *referenceIndex) mayContain(s string) bool {
+    k := len(s)
+    if k > idx.MaxK {
+        k = idx.MaxK
+    }
+    bits, ok := idx.Bitsets[k]
+    if !ok {
+        return true
+    }
+    for i := 0; i+k <= len(s); i++ {
+        v, ok := encodeKmer(s[i : i+k])
+        if ok && bits[v/64]&(1<<(v%64)) == 0 {
+            return false
+        }
+    }
+    return true
+}
+
+// needsScan reports whether locating s requires scanning the
+// chromosomes, i.e. the bitsets cannot prove it absent on both strands.
+func (idx *referenceIndex) needsScan(s string) bool {
+    return idx.mayContain(s) || idx.mayContain(reverseComplement(s))
+}
+
+type referenceOccurrence struct {
+    Chrom    string `json:"chrom"`
+    Position int    `json:"position"` // 1-based start on the forward strand
+    Strand   string `json:"strand"`
+}
+
+// find returns up to max occurrences of s on either strand.
+func (idx *referenceIndex) find(s string, max int) ([]referenceOccurrence, bool) {
+    occ := []referenceOccurrence{}
+    rc := reverseComplement(s)
+    strands := []struct {
+        seq    string
+        strand string
+    }{{s, "+"}}
+    if rc != s {
+        strands = append(strands, struct {
+            seq    string
+            strand string
+        }{rc, "-"})
+    }
+    for _, st := range strands {
+        if !idx.mayContain(st.seq) {
+            continue
+        }
+        needle := []byte(st.seq)
+        for _, ch := range idx.Chroms {
+            from := 0
+            for {
+                i := bytes.Index(ch.Seq[from:], needle)
+                if i < 0 {
+                    break
+                }
+                if len(occ) == max {
+                    return occ, true
+                }
+                occ = append(occ, referenceOccurrence{Chrom: ch.Name, Position: from + i + 1, Strand: st.strand})
+                from += i + 1
+            }
+        }
+    }
+    return occ, false
+}
+
+func reverseComplement(s string) string {
+    out := make([]byte, len(s))
+    for i := 0; i < len(s); i++ {
+        var b byte
+        switch s[i] {
+        case 'A':
+            b = 'T'
+        case 'C':
+            b = 'G'
+        case 'G':
+            b = 'C'
+        case 'T':
+            b = 'A'
+        default:
+            b = 'N'
+        }
+        out[len(s)-1-i] = b
+    }
+    return string(out)
+}
+
+// ------------------------------------------------------------------
+// verifyAbsenceHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: GET  /verify_absence?sequences=SEQ1,SEQ2&maxOccurrences=10
+//           POST /verify_absence  {"sequences": [...], "maxOccurrences": 10}
+//
+// Checks that the given neomers are absent from the local reference on
+// both strands and reports any occurrences with coordinates. At most
+// referenceMaxScans sequences per request that the k-mer bitsets cannot
+// rule out are scanned for; the others are reported as unverified.
+//
+func verifyAbsenceHandler(c *gin.Context) {
+    var req struct {
+        Sequences      []string `json:"sequences"`
+        MaxOccurrences int      `json:"maxOccurrences"`
+    }
+    if c.Request.Method == http.MethodPost {
+        if err := c.ShouldBindJSON(&req); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body: " + err.Error()})
+            return
+        }
+    } else {
+        for _, s := range strings.Split(c.Query("sequences"), ",") {
+            if strings.TrimSpace(s) != "" {
+                req.Sequences = append(req.Sequences, s)
+            }
+        }
+        req.MaxOccurrences, _ = strconv.Atoi(c.Query("maxOccurrences"))
+    }
+    if len(req.Sequences) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing sequences"})
+        return
+    }
+    if len(req.Sequences) > 10000 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "At most 10000 sequences per request"})
+        return
+    }
+    if req.MaxOccurrences <= 0 || req.MaxOccurrences > 1000 {
+        req.MaxOccurrences = 10
+    }
+
+    referenceMu.RLock()
+    idx, status, loadErr := reference, referenceStatus, referenceErr
+    referenceMu.RUnlock()
+    if idx == nil {
+        message := "reference is " + status + " (set NEOMERS_REFERENCE_FILE)"
+        if loadErr != nil {
+            message = loadErr.Error()
+        }
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": message, "status": status})
+        return
+    }
+
+    type verification struct {
+        Sequence    string                `json:"sequence"`
+        Absent      bool                  `json:"absent"`
+        Occurrences []referenceOccurrence `json:"occurrences"`
+        Truncated   bool                  `json:"truncated"`
+        Unverified  bool                  `json:"unverified,omitempty"`
+    }
+    results := make([]verification, 0, len(req.Sequences))
+    present, scans, unverified := 0, 0, 0
+    for _, raw := range req.Sequences {
+        seq, err := normalizeSequence(raw)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if idx.needsScan(seq) {
+            if scans == referenceMaxScans {
+                unverified++
+                results = append(results, verification{Sequence: seq, Occurrences: []referenceOccurrence{}, Unverified: true})
+                continue
+            }
+            scans++
+        }
+        occ, truncated := idx.find(seq, req.MaxOccurrences)
+        if len(occ) > 0 {
+            present++
+        }
+        results = append(results, verification{
+            Sequence:    seq,
+            Absent:      len(occ) == 0,
+            Occurrences: occ,
+            Truncated:   truncated,
+        })
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "reference": idx.Path,
+        "checked":    len(results),
+        "present":    present,
+        "unverified": unverified,
+        "results":    results,
+    })
+}
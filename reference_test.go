@@ -0,0 +1,187 @@
+package main
+
+import (
+    "bytes"
+    "encoding/binary"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// twoBitFile encodes sequences as a UCSC 2bit file. N runs become N
+// blocks and lower-case runs mask blocks.
+func twoBitFile(order binary.ByteOrder, version uint32, names, seqs []string) []byte {
+    runs := func(s string, in func(byte) bool) (starts, sizes []uint32) {
+        for i := 0; i < len(s); {
+            if !in(s[i]) {
+                i++
+                continue
+            }
+            j := i
+            for j < len(s) && in(s[j]) {
+                j++
+            }
+            starts, sizes = append(starts, uint32(i)), append(sizes, uint32(j-i))
+            i = j
+        }
+        return starts, sizes
+    }
+
+    var records [][]byte
+    for _, seq := range seqs {
+        var rec bytes.Buffer
+        w := func(v interface{}) { binary.Write(&rec, order, v) }
+        nStarts, nSizes := runs(seq, func(b byte) bool { return b == 'N' || b == 'n' })
+        mStarts, mSizes := runs(seq, func(b byte) bool { return b >= 'a' && b <= 'z' })
+        w(uint32(len(seq)))
+        w(uint32(len(nStarts)))
+        w(nStarts)
+        w(nSizes)
+        w(uint32(len(mStarts)))
+        w(mStarts)
+        w(mSizes)
+        w(uint32(0))
+        packed := make([]byte, (len(seq)+3)/4)
+        for i := 0; i < len(seq); i++ {
+            code := strings.IndexByte("TCAG", seq[i]&^0x20) // N packs as T
+            if code < 0 {
+                code = 0
+            }
+            packed[i/4] |= byte(code) << (6 - 2*(i%4))
+        }
+        rec.Write(packed)
+        records = append(records, rec.Bytes())
+    }
+
+    var f bytes.Buffer
+    w := func(v interface{}) { binary.Write(&f, order, v) }
+    w([]uint32{0x1A412743, version, uint32(len(seqs)), 0})
+    offset := 16
+    for _, name := range names {
+        offset += 1 + len(name) + 4
+        if version == 1 {
+            offset += 4
+        }
+    }
+    for i, name := range names {
+        f.WriteByte(byte(len(name)))
+        f.WriteString(name)
+        if version == 1 {
+            w(uint64(offset))
+        } else {
+            w(uint32(offset))
+        }
+        offset += len(records[i])
+    }
+    for _, rec := range records {
+        f.Write(rec)
+    }
+    return f.Bytes()
+}
+
+func TestReadTwoBit(t *testing.T) {
+    names := []string{"chr1", "chrM"}
+    seqs := []string{"ACGTNNNNacgtACGTTGCA", "GGGCCCnnAAATTTg"}
+    want := []referenceChrom{
+        {Name: "chr1", Seq: []byte("ACGTNNNNACGTACGTTGCA")},
+        {Name: "chrM", Seq: []byte("GGGCCCNNAAATTTG")},
+    }
+    for _, tc := range []struct {
+        name    string
+        order   binary.ByteOrder
+        version uint32
+    }{
+        {"little endian v0", binary.LittleEndian, 0},
+        {"big endian v0", binary.BigEndian, 0},
+        {"little endian v1", binary.LittleEndian, 1},
+    } {
+        chroms, err := readTwoBit(bytes.NewReader(twoBitFile(tc.order, tc.version, names, seqs)))
+        if err != nil {
+            t.Errorf("%s: %v", tc.name, err)
+            continue
+        }
+        if !reflect.DeepEqual(chroms, want) {
+            t.Errorf("%s: got %q, want %q", tc.name, chroms, want)
+        }
+    }
+
+    bad := []struct {
+        name string
+        file []byte
+        err  string
+    }{
+        {"signature", []byte("\x00\x01\x02\x03\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), "not a 2bit file"},
+        {"version", twoBitFile(binary.LittleEndian, 2, names, seqs), "unsupported 2bit version"},
+        {"truncated", twoBitFile(binary.LittleEndian, 0, names, seqs)[:60], ""},
+    }
+    for _, tc := range bad {
+        _, err := readTwoBit(bytes.NewReader(tc.file))
+        if err == nil || !strings.Contains(err.Error(), tc.err) {
+            t.Errorf("%s: got error %v, want one containing %q", tc.name, err, tc.err)
+        }
+    }
+}
+
+func TestReadFasta(t *testing.T) {
+    chroms, err := readFasta(strings.NewReader(">chr1 assembled chromosome\nACGTN\nacgt\n\n>chr2\r\nTTTT\r\n>empty\n>chr3\nggCC"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []referenceChrom{
+        {Name: "chr1", Seq: []byte("ACGTNACGT")},
+        {Name: "chr2", Seq: []byte("TTTT")},
+        {Name: "empty", Seq: []byte{}},
+        {Name: "chr3", Seq: []byte("GGCC")},
+    }
+    if !reflect.DeepEqual(chroms, want) {
+        t.Errorf("got %q, want %q", chroms, want)
+    }
+
+    if _, err := readFasta(strings.NewReader("ACGT\n>chr1\nACGT\n")); err == nil {
+        t.Error("sequence before the first header was accepted")
+    }
+}
+
+func TestReferenceIndex(t *testing.T) {
+    chroms := []referenceChrom{
+        {Name: "chr1", Seq: []byte("ACGTACGTTAGCCATGNNNNGATTACAGATTACA")},
+        {Name: "chr2", Seq: []byte("TTTTTCCCCCAAAAAGGGGG")},
+    }
+    idx := &referenceIndex{Chroms: chroms, MaxK: 12, Bitsets: map[int][]uint64{}}
+    idx.buildBitsets()
+
+    cases := []struct {
+        name    string
+        seq     string
+        forward bool // mayContain, which checks the forward strand only
+        occ     []referenceOccurrence
+    }{
+        {"forward 11-mer", "CGTACGTTAGC", true, []referenceOccurrence{{"chr1", 2, "+"}}},
+        {"forward 12-mer", "CGTACGTTAGCC", true, []referenceOccurrence{{"chr1", 2, "+"}}},
+        {"reverse strand 11-mer", "CTTTTTGGGGG", false, []referenceOccurrence{{"chr2", 6, "-"}}},
+        {"reverse strand 12-mer", "TTGGGGGAAAAA", false, []referenceOccurrence{{"chr2", 1, "-"}}},
+        {"longer than the index", "TTTTTCCCCCAAAAAG", true, []referenceOccurrence{{"chr2", 1, "+"}}},
+        {"absent 11-mer", "ACGTACGTACG", false, nil},
+        {"absent long sequence", "ACGTACGTTAGCCATGG", false, nil},
+        {"N windows prove nothing", "CCATGNNNNGATT", true, []referenceOccurrence{{"chr1", 12, "+"}}},
+        {"after an N block", "GATTACAGATT", true, []referenceOccurrence{{"chr1", 21, "+"}}},
+    }
+    for _, tc := range cases {
+        if got := idx.mayContain(tc.seq); got != tc.forward {
+            t.Errorf("%s: mayContain = %v, want %v", tc.name, got, tc.forward)
+        }
+        if got := idx.needsScan(tc.seq); got != (len(tc.occ) > 0) {
+            t.Errorf("%s: needsScan = %v, want %v", tc.name, got, len(tc.occ) > 0)
+        }
+        occ, truncated := idx.find(tc.seq, 10)
+        if truncated || len(occ) != len(tc.occ) || (len(occ) > 0 && !reflect.DeepEqual(occ, tc.occ)) {
+            t.Errorf("%s: find = %v (truncated %v), want %v", tc.name, occ, truncated, tc.occ)
+        }
+    }
+
+    // ACGT occurs at 1 and 5 and is its own reverse complement
+    occ, truncated := idx.find("ACGT", 1)
+    if !truncated || !reflect.DeepEqual(occ, []referenceOccurrence{{"chr1", 1, "+"}}) {
+        t.Errorf("find with max 1 = %v (truncated %v), want the first, truncated", occ, truncated)
+    }
+}
@@ -20,6 +20,14 @@ var db *sql.DB
 var dbInitErr error
 
 func main() {
+    // Offline jobs run as subcommands, e.g. "train-classifier"
+    if len(os.Args) > 1 {
+        if err := runSubcommand(os.Args[1], os.Args[2:]); err != nil {
+            log.Fatalf("%s: %v", os.Args[1], err)
+        }
+        return
+    }
+
     // Initialize global database connection once
     dbInitErr = initializeDatabase()
     if dbInitErr != nil {
@@ -27,7 +35,17 @@ func main() {
     } else {
         defer db.Close()
         log.Println("Database initialized with resource limits: memory_limit=8GB, threads=3")
+        go buildSuggestionCache()
+    }
+
+    // Load the optional local reference genome in the background
+    if path := getReferencePath(); path != "" {
+        go initReference(path)
+    }
+    if path := getClassifierModelPath(); path != "" {
+        loadClassifier(path)
     }
+    loadCohorts(getCohortsPath())
 
     router := gin.Default()
 
@@ -42,12 +60,17 @@ func main() {
         }))
 
     router.GET("/healthcheck", healthCheckHandler)
+    router.GET("/verify_absence", verifyAbsenceHandler)
+    router.POST("/verify_absence", verifyAbsenceHandler)
+    router.POST("/classify", classifyHandler)
     router.Use(requireDatabase())
-    router.GET("/cancer_types", makeHandler("SELECT * FROM cancer_types"))
-    router.GET("/donor_data", makeHandler("SELECT * FROM donor_data"))
-    router.GET("/exomes_donor_data", makeHandler("SELECT * FROM exome_donor_data"))
+    router.GET("/cancer_types", tableRowsHandler("cancer_types"))
+    router.GET("/donor_data", tableRowsHandler("donor_data"))
+    router.GET("/exomes_donor_data", tableRowsHandler("exome_donor_data"))
 
-    router.GET("/tcga_survival_data", makeHandler("SELECT * FROM tcga_survival_data"))
+    router.GET("/tcga_survival_data", tableRowsHandler("tcga_survival_data"))
+    router.GET("/donors", getDonorsHandler)
+    router.GET("/donors/summary", getDonorsSummaryHandler)
 
     // Neomers
     router.GET("/get_nullomers", getNullomersHandler)
@@ -70,16 +93,54 @@ func main() {
     router.GET("/jaccard_index_organs", getJaccardIndexOrgansHandler)
 
     router.GET("/dataset_stats_cancer_types_varying_k", getDatasetStatsCancerTypesVaryingKHandler)
+    router.GET("/trends", getTrendsHandler)
+    router.GET("/facets", getFacetsHandler)
+    router.GET("/stats", getStatsHandler)
+    router.GET("/pivot", getPivotHandler)
     
     router.GET("/distribution_neomer/:K/cancer_types", getDistNeomerKCancerTypes)
     router.GET("/distribution_neomer/:K/organs", getDistNeomerKOrgans)
     router.GET("/distribution_neomer/:K/data_by_cancer_type", getDistNeomerKDataByCancerType)
     router.GET("/distribution_neomer/:K/data_by_organ", getDistNeomerKDataByOrgan)
+    router.GET("/distribution_neomer/:K/summary", getDistributionSummaryHandler)
+    router.GET("/distribution_neomer/:K/compare", getDistributionCompareHandler)
     
     router.GET("/exome_patient_details", getExomePatientDetailsHandler)
     router.GET("/exome_patient_neomers",  getExomePatientNeomersHandler)
     router.GET("/exome_analyze_neomer", getExomeAnalyzeNeomerHandler )
 
+    // Cross-K hierarchy
+    router.GET("/neomer_hierarchy", getNeomerHierarchyHandler)
+
+    // Genes
+    router.GET("/genes", getGenesHandler)
+    router.GET("/gene_details", getGeneDetailsHandler)
+    router.GET("/cooccurrence", getCooccurrenceHandler)
+    router.GET("/panel_design", getPanelDesignHandler)
+    router.GET("/rarefaction", getRarefactionHandler)
+    router.GET("/sbs96", getSBS96Handler)
+
+    // Population allele frequencies
+    router.GET("/af_histogram", getAFHistogramHandler)
+    router.GET("/population_specific_neomers", getPopulationSpecificNeomersHandler)
+    router.GET("/af_classification", getAFClassificationHandler)
+
+    // Genome vs exome
+    router.GET("/dataset_concordance", getDatasetConcordanceHandler)
+    router.POST("/analyze_neomers_batch", analyzeNeomersBatchHandler)
+
+    // Patients
+    router.GET("/patient_profile", getPatientProfileHandler)
+    router.GET("/patient_burden", getPatientBurdenHandler)
+    router.GET("/burden_association", getBurdenAssociationHandler)
+
+    // Cohorts
+    router.POST("/cohorts", createCohortHandler)
+    router.GET("/cohorts", listCohortsHandler)
+    router.GET("/cohorts/:id", getCohortHandler)
+    router.DELETE("/cohorts/:id", deleteCohortHandler)
+    router.POST("/cohort_comparison", compareCohortsHandler)
+
 
     
     if err := router.Run(); err != nil {
@@ -99,11 +160,15 @@ func corsMiddleware() gin.HandlerFunc {
 }
 
 func healthCheckHandler(c *gin.Context) {
+    referenceMu.RLock()
+    refStatus := referenceStatus
+    referenceMu.RUnlock()
+
     if dbInitErr != nil {
-        c.JSON(http.StatusOK, gin.H{"status": "healthy", "database": "unavailable", "error": dbInitErr.Error()})
+        c.JSON(http.StatusOK, gin.H{"status": "healthy", "database": "unavailable", "error": dbInitErr.Error(), "reference": refStatus})
         return
     }
-    c.JSON(http.StatusOK, gin.H{"status": "healthy", "database": "available"})
+    c.JSON(http.StatusOK, gin.H{"status": "healthy", "database": "available", "reference": refStatus})
 }
 
 func initializeDatabase() error {
@@ -146,52 +211,6 @@ func requireDatabase() gin.HandlerFunc {
     }
 }
 
-func makeHandler(query string) func(*gin.Context) {
-    return func(c *gin.Context) {
-        rows, err := db.Query(query)
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-        defer rows.Close()
-
-        columns, err := rows.Columns()
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-
-        data := make([][]interface{}, 0)
-        for rows.Next() {
-            row := make([]interface{}, len(columns))
-            rowPointers := make([]interface{}, len(columns))
-            for i := range row {
-                rowPointers[i] = &row[i]
-            }
-
-            if err := rows.Scan(rowPointers...); err != nil {
-                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-                return
-            }
-
-            // Convert []byte data to string, if applicable
-            for i, val := range row {
-                if b, ok := val.([]byte); ok {
-                    row[i] = string(b)
-                }
-            }
-            data = append(data, row)
-        }
-
-        result := map[string]interface{}{
-            "headers": columns,
-            "data":    data,
-        }
-
-        c.JSON(http.StatusOK, result)
-    }
-}
-
 func getDatabasePath() string {
     if path := os.Getenv("NEOMERS_DUCK_DB_FILE"); path != "" {
         return path
@@ -244,6 +263,15 @@ func getNullomersHandler(c *gin.Context) {
         limit = l
     }
 
+    // Optional saved cohort
+    cohortWhere, cohortArgs, ok := cohortDonorClause(c, "genome", "di.Actual_Donor_ID")
+    if !ok {
+        return
+    }
+    if cohortWhere != "" {
+        cohortWhere = "WHERE " + cohortWhere
+    }
+
     // 1) Base CTE
     baseQuery := fmt.Sprintf(`
         WITH base AS (
@@ -265,9 +293,10 @@ func getNullomersHandler(c *gin.Context) {
             JOIN cancer_type_details c USING (Project_Code)
             LEFT JOIN donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
             LEFT JOIN donor_data d ON di.Actual_Donor_ID = d.icgc_donor_id
+            %[2]s
         )
         SELECT * FROM base
-    `, length)
+    `, length, cohortWhere)
 
     // Build WHERE clauses
     var whereClauses []string
@@ -347,13 +376,14 @@ func getNullomersHandler(c *gin.Context) {
             JOIN cancer_type_details c USING (Project_Code)
             LEFT JOIN donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
             LEFT JOIN donor_data d ON di.Actual_Donor_ID = d.icgc_donor_id
+            %[2]s
         )
         SELECT COUNT(*) FROM base
-        %s
-    `, length, finalWhere)
+        %[3]s
+    `, length, cohortWhere, finalWhere)
 
     var totalCount int
-    if err := db.QueryRow(countQuery).Scan(&totalCount); err != nil {
+    if err := db.QueryRow(countQuery, cohortArgs...).Scan(&totalCount); err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
@@ -361,7 +391,7 @@ func getNullomersHandler(c *gin.Context) {
     // 3) Data page
     offset := page * limit
     pageQuery := fmt.Sprintf("%s %s LIMIT %d OFFSET %d", baseQuery, finalWhere, limit, offset)
-    rows, err := db.Query(pageQuery)
+    rows, err := db.Query(pageQuery, cohortArgs...)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -446,251 +476,17 @@ func isNumericColumn(column string) bool {
 // ------------------------------------------------------------------
 // getSuggestionsHandler
 // ------------------------------------------------------------------
-// ------------------------------------------------------------------
-// getSuggestionsHandler
-// ------------------------------------------------------------------
+// Autocomplete values of a genome listing column (see suggestionsHandler).
 func getSuggestionsHandler(c *gin.Context) {
-	column := c.Query("column")
-	input := c.Query("input")
-	length := c.Query("length")
-
-	if length == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required parameter 'length'"})
-		return
-	}
-	if column == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required parameter 'column'"})
-		return
-	}
-
-	// It's not meaningful to get suggestions for a purely numeric column like this
-	if column == "gc_content" {
-		c.JSON(http.StatusOK, gin.H{"suggestions": []string{}})
-		return
-	}
-
-	lowerInput := strings.ToLower(input)
-	var whereClause string
-	if lowerInput != "" {
-		// Use CAST to VARCHAR to safely perform a LIKE search on any column type
-		whereClause = fmt.Sprintf("WHERE LOWER(CAST(%s AS VARCHAR)) LIKE '%%%s%%'", column, lowerInput)
-	}
-
-	// This query now joins all relevant tables, allowing suggestions from any of them.
-	query := fmt.Sprintf(`
-        WITH base AS (
-            SELECT DISTINCT %s
-            FROM neomers_%s n
-            JOIN cancer_type_details c USING (Project_Code)
-            LEFT JOIN donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
-            LEFT JOIN donor_data d ON di.Actual_Donor_ID = d.icgc_donor_id
-            %s
-            LIMIT 10
-        )
-        SELECT %s
-        FROM base
-		WHERE %s IS NOT NULL
-        ORDER BY LOWER(CAST(%s AS VARCHAR)) ASC
-    `, column, length, whereClause, column, column, column)
-
-	rows, err := db.Query(query)
-	if err != nil {
-		// Log the error and return empty suggestions to prevent frontend issues
-		log.Printf("Suggestion query failed for column '%s': %v", column, err)
-		c.JSON(http.StatusOK, gin.H{"suggestions": []string{}})
-		return
-	}
-	defer rows.Close()
-
-	var suggestions []string
-	for rows.Next() {
-		var val interface{}
-		if err := rows.Scan(&val); err == nil {
-			if v, ok := val.(string); ok {
-				suggestions = append(suggestions, v)
-			} else if val != nil {
-				// Convert non-string types to their string representation for the response
-				suggestions = append(suggestions, fmt.Sprintf("%v", val))
-			}
-		}
-	}
-	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+    suggestionsHandler(c, "genome")
 }
 
 // ------------------------------------------------------------------
 // getNullomersStatsHandler
 // ------------------------------------------------------------------
+// Rows per neomer and groupBy columns (see legacyStatsHandler; /stats is the general form).
 func getNullomersStatsHandler(c *gin.Context) {
-    length := c.Query("length")
-    if length == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required parameter 'length'"})
-        return
-    }
-
-    filters := c.Query("filters")
-    specialFilters := c.Query("specialFilters")
-    groupByStr := c.Query("groupBy")
-    topNStr := c.Query("topN")
-
-    // NEW: single “between” filter
-    column := c.Query("column")
-    filterType := c.Query("filterType")
-    filterValue := c.Query("value")
-
-    topN := 10
-    if n, err := strconv.Atoi(topNStr); err == nil && n > 0 {
-        topN = n
-    }
-
-    // Base CTE
-    baseCTE := fmt.Sprintf(`
-        WITH base AS (
-            SELECT
-                n.* EXCLUDE (Donor_ID),
-                c.*,
-                d.*,
-                di.Tumor_Sample_Barcode,
-                di.Matched_Norm_Sample_Barcode,
-                ROUND(
-                    100.0 * (
-                        LENGTH(n.nullomers_created)
-                        - LENGTH(REPLACE(UPPER(n.nullomers_created), 'G', ''))
-                        - LENGTH(REPLACE(UPPER(n.nullomers_created), 'C', ''))
-                    ) / LENGTH(n.nullomers_created),
-                    2
-                ) * -1 AS gc_content
-            FROM neomers_%[1]s n
-            JOIN cancer_type_details c USING (Project_Code)
-            LEFT JOIN donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
-            LEFT JOIN donor_data d ON di.Actual_Donor_ID = d.icgc_donor_id
-        )
-    `, length)
-
-    // Build WHERE clauses
-    var whereClauses []string
-
-    // a) “Between” filter
-    if filterType == "between" && column != "" && filterValue != "" {
-        parts := strings.Split(filterValue, ",")
-        if len(parts) == 2 {
-            minVal := parts[0]
-            maxVal := parts[1]
-            whereClauses = append(whereClauses,
-                fmt.Sprintf(
-                    `CAST("%s" AS FLOAT) >= %s AND CAST("%s" AS FLOAT) <= %s`,
-                    column, minVal, column, maxVal,
-                ),
-            )
-        }
-    } else if filters != "" {
-        // b) Legacy filters
-        for _, cond := range strings.Split(filters, " AND ") {
-            parts := strings.Fields(cond)
-            if len(parts) >= 3 {
-                col := cleanColumnName(parts[0])
-                if isNumericColumn(col) {
-                    cond = fmt.Sprintf(`CAST("%s" AS FLOAT) %s %s`,
-                        col, parts[1], removeParentheses(parts[2]))
-                }
-                whereClauses = append(whereClauses, cond)
-            }
-        }
-    }
-
-    // c) Special filters
-    if specialFilters != "" {
-        for _, part := range strings.Split(specialFilters, "|") {
-            sf := strings.Split(part, ";")
-            if sf[0] == "at_least_X_distinct_patients" && len(sf) == 2 {
-                if n, err := strconv.Atoi(sf[1]); err == nil && n > 0 {
-                    sub := fmt.Sprintf(`
-                        nullomers_created IN (
-                            SELECT nullomers_created
-                            FROM neomers_%[1]s
-                            JOIN cancer_type_details USING (Project_Code)
-                            LEFT JOIN donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
-                            LEFT JOIN donor_data d ON di.Actual_Donor_ID = d.icgc_donor_id
-                            GROUP BY nullomers_created
-                            HAVING COUNT(DISTINCT donor_id) >= %d
-                        )`, length, n)
-                    whereClauses = append(whereClauses, sub)
-                }
-            }
-        }
-    }
-
-    finalWhere := ""
-    if len(whereClauses) > 0 {
-        finalWhere = " WHERE " + strings.Join(whereClauses, " AND ")
-    }
-
-    // Prepare GROUP BY
-    groupByCols := []string{"nullomers_created"}
-    selectCols := []string{"nullomers_created"}
-    if groupByStr != "" {
-        for _, col := range strings.Split(groupByStr, ",") {
-            col = strings.TrimSpace(col)
-            if col != "" {
-                groupByCols = append(groupByCols, col)
-                selectCols = append(selectCols, col)
-            }
-        }
-    }
-    selectClause := strings.Join(selectCols, ", ")
-    groupByClause := strings.Join(groupByCols, ", ")
-
-    // Final stats query
-    query := fmt.Sprintf(`
-        %s
-        SELECT
-            %s,
-            COUNT(*) AS total_count
-        FROM base
-        %s
-        GROUP BY %s
-        ORDER BY total_count DESC
-        LIMIT %d
-    `, baseCTE, selectClause, finalWhere, groupByClause, topN)
-
-    rows, err := db.Query(query)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-    defer rows.Close()
-
-    cols, err := rows.Columns()
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-
-    var data [][]interface{}
-    for rows.Next() {
-        row := make([]interface{}, len(cols))
-        ptrs := make([]interface{}, len(cols))
-        for i := range row {
-            ptrs[i] = &row[i]
-        }
-        if err := rows.Scan(ptrs...); err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-        for i, v := range row {
-            if b, ok := v.([]byte); ok {
-                row[i] = string(b)
-            }
-            if v == nil {
-                row[i] = nil
-            }
-        }
-        data = append(data, row)
-    }
-
-    c.JSON(http.StatusOK, gin.H{
-        "headers": cols,
-        "data":    data,
-    })
+    legacyStatsHandler(c, "genome")
 }
 
 // GET /exome_nullomers?length=<L>&page=<P>&limit=<N>&filters=…&specialFilters=…&column=…&filterType=between&value=…
@@ -709,6 +505,15 @@ func getExomeNullomersHandler(c *gin.Context) {
     filters := c.Query("filters")
     specialFilters := c.Query("specialFilters")
 
+    // Optional saved cohort
+    cohortWhere, cohortArgs, ok := cohortDonorClause(c, "exome", "di.Actual_Donor_ID")
+    if !ok {
+        return
+    }
+    if cohortWhere != "" {
+        cohortWhere = "WHERE " + cohortWhere
+    }
+
     // Build WHERE parts
     var whereParts []string
     if filters != "" {
@@ -768,14 +573,15 @@ WITH base AS (
         ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
     LEFT JOIN exome_donor_data AS d
         ON di.Actual_Donor_ID = d.bcr_patient_barcode
+    %[2]s
 )
-`, length)
+`, length, cohortWhere)
 
     // 2) Total count
     countQ := baseCTE + "SELECT COUNT(*) FROM base" + finalWhere
 
     var totalCount int
-    if err := db.QueryRow(countQ).Scan(&totalCount); err != nil {
+    if err := db.QueryRow(countQ, cohortArgs...).Scan(&totalCount); err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
@@ -786,7 +592,7 @@ WITH base AS (
         "SELECT * FROM base" + finalWhere +
         fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
 
-    rows, err := db.Query(pageQ)
+    rows, err := db.Query(pageQ, cohortArgs...)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -826,194 +632,12 @@ WITH base AS (
 
 // getExomeSuggestionsHandler returns autocomplete suggestions for exome nullomer filters
 func getExomeSuggestionsHandler(c *gin.Context) {
-    column := c.Query("column")
-    input := c.Query("input")
-    length := c.Query("length")
-    if length == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing length"})
-        return
-    }
-    if column == "gc_content" {
-        c.JSON(http.StatusOK, gin.H{"suggestions": []string{}})
-        return
-    }
-
-    lowerInput := strings.ToLower(input)
-    cond := ""
-    if lowerInput != "" {
-        cond = fmt.Sprintf("WHERE LOWER(%s) LIKE '%%%s%%'", column, lowerInput)
-    }
-
-    query := fmt.Sprintf(`
-        WITH base AS (
-            SELECT DISTINCT %s
-            FROM exome_neomers_%s n
-            JOIN exomes_donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
-            JOIN exome_donor_data d ON di.Actual_Donor_ID = d.bcr_patient_barcode
-            %s
-            LIMIT 10
-        )
-        SELECT %s
-        FROM base
-        ORDER BY LOWER(%s) ASC
-    `, column, length, cond, column, column)
-
-    rows, err := db.Query(query)
-    if err != nil {
-        c.JSON(http.StatusOK, gin.H{"suggestions": []string{}})
-        return
-    }
-    defer rows.Close()
-
-    var suggestions []string
-    for rows.Next() {
-        var val interface{}
-        if err := rows.Scan(&val); err != nil {
-            continue
-        }
-        if s, ok := val.(string); ok {
-            suggestions = append(suggestions, s)
-        } else if val != nil {
-            suggestions = append(suggestions, fmt.Sprintf("%v", val))
-        }
-    }
-
-    c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+    suggestionsHandler(c, "exome")
 }
 
 // GET /exome_nullomers_stats?length=<L>&filters=…&specialFilters=…&groupBy=…&topN=…&column=…&filterType=between&value=…
 func getExomeNullomersStatsHandler(c *gin.Context) {
-    length := c.Query("length")
-    if length == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required parameter 'length'"})
-        return
-    }
-    filters := c.Query("filters")
-    specialFilters := c.Query("specialFilters")
-    groupByStr := c.Query("groupBy")
-    topNStr := c.Query("topN")
-
-    topN := 10
-    if n, err := strconv.Atoi(topNStr); err == nil && n > 0 {
-        topN = n
-    }
-
-    // Build WHERE parts (with casting for numeric columns)...
-    var whereParts []string
-    if filters != "" {
-        numericCols := []string{
-            "gc_content",
-            "AF", "AF_eas", "AF_afr", "AF_fin", "AF_ami",
-            "AF_amr", "AF_nfe", "AF_sas", "AF_asj",
-            "days_to_birth", "days_to_death", "days_to_last_followup",
-        }
-        pattern := `\b(` + strings.Join(numericCols, "|") + `)\s*(>=|<=|>|<|=)\s*([0-9]+(?:\.[0-9]+)?)`
-        re := regexp.MustCompile(pattern)
-        filtersCast := re.ReplaceAllString(filters, `CAST($1 AS DOUBLE) $2 $3`)
-        whereParts = append(whereParts, filtersCast)
-    }
-    if specialFilters != "" {
-        for _, part := range strings.Split(specialFilters, "|") {
-            sf := strings.Split(part, ";")
-            if len(sf) == 2 && sf[0] == "at_least_X_distinct_patients" {
-                if n, err := strconv.Atoi(sf[1]); err == nil && n > 0 {
-                    sub := fmt.Sprintf(
-                        `"nullomers_created" IN (
-                            SELECT "nullomers_created"
-                            FROM exome_neomers_%s
-                            GROUP BY "nullomers_created"
-                            HAVING COUNT(DISTINCT "Donor_ID") >= %d
-                         )`, length, n)
-                    whereParts = append(whereParts, sub)
-                }
-            }
-        }
-    }
-    finalWhere := ""
-    if len(whereParts) > 0 {
-        finalWhere = " WHERE " + strings.Join(whereParts, " AND ")
-    }
-
-    // 1) Base CTE: include ALL donor‐data columns (d.*) plus mapping cols
-    baseCTE := fmt.Sprintf(`
-WITH base AS (
-    SELECT
-        n.* EXCLUDE(Donor_ID),
-        di.Tumor_Sample_Barcode,
-        di.Matched_Norm_Sample_Barcode,
-        d.*,  -- bring in every column from exome_donor_data
-        ROUND(
-            100.0 * (
-                LENGTH(n.nullomers_created)
-                - LENGTH(REPLACE(UPPER(n.nullomers_created), 'G', ''))
-                - LENGTH(REPLACE(UPPER(n.nullomers_created), 'C', ''))
-            ) / LENGTH(n.nullomers_created),
-            2
-        ) * -1 AS gc_content
-    FROM exome_neomers_%s AS n
-    JOIN exomes_donor_id_mapping AS di
-        ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
-    LEFT JOIN exome_donor_data AS d
-        ON di.Actual_Donor_ID = d.bcr_patient_barcode
-)
-`, length)
-
-    // 2) Build GROUP BY / SELECT
-    groupByCols := []string{"nullomers_created"}
-    selectCols := []string{"nullomers_created"}
-    if groupByStr != "" {
-        for _, col := range strings.Split(groupByStr, ",") {
-            col = strings.TrimSpace(col)
-            if col != "" {
-                groupByCols = append(groupByCols, col)
-                selectCols = append(selectCols, col)
-            }
-        }
-    }
-    selectClause := strings.Join(selectCols, ", ")
-    groupByClause  := strings.Join(groupByCols, ", ")
-
-    // 3) Stats query
-    statsQ := baseCTE +
-        fmt.Sprintf(
-            "SELECT %s, COUNT(*) AS total_count FROM base%s GROUP BY %s ORDER BY total_count DESC LIMIT %d",
-            selectClause, finalWhere, groupByClause, topN,
-        )
-
-    rows, err := db.Query(statsQ)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-    defer rows.Close()
-
-    cols, _ := rows.Columns()
-    var data [][]interface{}
-    for rows.Next() {
-        vals := make([]interface{}, len(cols))
-        ptrs := make([]interface{}, len(cols))
-        for i := range vals {
-            ptrs[i] = &vals[i]
-        }
-        if err := rows.Scan(ptrs...); err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-        for i, v := range vals {
-            if b, ok := v.([]byte); ok {
-                vals[i] = string(b)
-            }
-            if v == nil {
-                vals[i] = nil
-            }
-        }
-        data = append(data, vals)
-    }
-
-    c.JSON(http.StatusOK, gin.H{
-        "headers": cols,
-        "data":    data,
-    })
+    legacyStatsHandler(c, "exome")
 }
 
 
@@ -1215,6 +839,16 @@ func analyzeNeomerHandler(c *gin.Context) {
 
 	tableName := fmt.Sprintf("neomers_%d", K)
 
+	// Optional saved cohort
+	cohortWhere, cohortArgs, ok := cohortDonorClause(c, "genome", "di.Actual_Donor_ID")
+	if !ok {
+		return
+	}
+	if cohortWhere != "" {
+		cohortWhere = "AND " + cohortWhere
+	}
+	args := append([]interface{}{neomer}, cohortArgs...)
+
 	// —— First query: overall stats ——
 	totalQuery := fmt.Sprintf(`
 		SELECT
@@ -1227,10 +861,11 @@ func analyzeNeomerHandler(c *gin.Context) {
 		JOIN donor_id_mapping   di        ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
 		/* JOIN donor_data         d         ON di.Actual_Donor_ID = d.icgc_donor_id -- Not needed for these counts */
 		WHERE n.nullomers_created = ?
-	`, tableName)
+		%s
+	`, tableName, cohortWhere)
 
 	var totalCount, distinctDonors, distinctCancerTypes, distinctOrgans int
-	if err := db.QueryRow(totalQuery, neomer).Scan(
+	if err := db.QueryRow(totalQuery, args...).Scan(
 		&totalCount, &distinctDonors, &distinctCancerTypes, &distinctOrgans,
 	); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching total stats: " + err.Error()})
@@ -1248,10 +883,11 @@ func analyzeNeomerHandler(c *gin.Context) {
 		JOIN donor_id_mapping   di        ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
 		/* JOIN donor_data         d         ON di.Actual_Donor_ID = d.icgc_donor_id -- Not needed for this breakdown */
 		WHERE n.nullomers_created = ?
+		%s
 		GROUP BY c.Cancer_Type, c.Organ
-	`, tableName)
+	`, tableName, cohortWhere)
 
-	rows, err := db.Query(breakdownQuery, neomer)
+	rows, err := db.Query(breakdownQuery, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching breakdown stats: " + err.Error()})
 		return
@@ -1294,9 +930,10 @@ func analyzeNeomerHandler(c *gin.Context) {
 		FROM %s n
 		JOIN donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
 		WHERE n.nullomers_created = ?
-	`, tableName)
+		%s
+	`, tableName, cohortWhere)
 
-	donorRows, err := db.Query(distinctDonorIDsQuery, neomer)
+	donorRows, err := db.Query(distinctDonorIDsQuery, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching distinct donor IDs: " + err.Error()})
 		return
@@ -1355,6 +992,16 @@ func getJaccardIndexHandler(c *gin.Context) {
     // Construct the table name safely
     tableName := fmt.Sprintf("neomers_%s", K)
 
+    // Optional saved cohort
+    cohortWhere, cohortArgs, ok := cohortDonorClause(c, "genome", "di.Actual_Donor_ID")
+    if !ok {
+        return
+    }
+    cohortJoin := ""
+    if cohortWhere != "" {
+        cohortJoin = `JOIN donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID" WHERE ` + cohortWhere
+    }
+
     // Define the SQL query to compute Jaccard indices for all pairs,
     //  (though for Jaccard across cancer types,
     // the main references remain nullomers + cancer_type_details).
@@ -1366,6 +1013,7 @@ func getJaccardIndexHandler(c *gin.Context) {
             SELECT n.nullomers_created, c.Cancer_Type
             FROM %s n
             JOIN cancer_type_details c USING (Project_Code)
+            %s
         ),
         cancer_counts AS (
             SELECT Cancer_Type, COUNT(DISTINCT nullomers_created) AS count
@@ -1413,10 +1061,10 @@ func getJaccardIndexHandler(c *gin.Context) {
         JOIN cancer_counts c2 
             ON p.Cancer_Type_B = c2.Cancer_Type
         ORDER BY p.Cancer_Type_A, p.Cancer_Type_B;
-    `, tableName)
+    `, tableName, cohortJoin)
 
     // Execute the query
-    rows, err := db.Query(query)
+    rows, err := db.Query(query, cohortArgs...)
     if err != nil {
         log.Printf("Error executing query: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to execute query"})
@@ -1486,6 +1134,16 @@ func getJaccardIndexOrgansHandler(c *gin.Context) {
     // Construct the table name safely
     tableName := fmt.Sprintf("neomers_%s", K)
 
+    // Optional saved cohort
+    cohortWhere, cohortArgs, ok := cohortDonorClause(c, "genome", "di.Actual_Donor_ID")
+    if !ok {
+        return
+    }
+    cohortJoin := ""
+    if cohortWhere != "" {
+        cohortJoin = `JOIN donor_id_mapping di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID" WHERE ` + cohortWhere
+    }
+
     // Define the SQL query to compute Jaccard indices for all pairs,
     // (though for Jaccard across organs
     // the main references remain nullomers + cancer_type_details).
@@ -1497,6 +1155,7 @@ func getJaccardIndexOrgansHandler(c *gin.Context) {
             SELECT n.nullomers_created, c.Organ
             FROM %s n
             JOIN cancer_type_details c USING (Project_Code)
+            %s
         ),
         organ_counts AS (
             SELECT Organ, COUNT(DISTINCT nullomers_created) AS count
@@ -1544,10 +1203,10 @@ func getJaccardIndexOrgansHandler(c *gin.Context) {
         JOIN organ_counts c2 
             ON p.Organ_B = c2.Organ
         ORDER BY p.Organ_A, p.Organ_B;
-    `, tableName)
+    `, tableName, cohortJoin)
 
     // Execute the query
-    rows, err := db.Query(query)
+    rows, err := db.Query(query, cohortArgs...)
     if err != nil {
         log.Printf("Error executing query: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to execute query"})
@@ -1593,49 +1252,57 @@ func getJaccardIndexOrgansHandler(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{"jaccard_indices": results})
 }
 
+// GET /dataset_stats_cancer_types_varying_k
+// Returns {"stats": {"11": [{ cancer_type, count }, …], …}}: neomer rows per
+// cancer type for every available K from 11 to 16. See /trends for other
+// groupings and measures.
+func getDatasetStatsCancerTypesVaryingKHandler(c *gin.Context) {
+    ks, err := availableKs("neomers_")
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
 
-func getDatasetStatsCancerTypesVaryingKHandler(c *gin.Context){
-    lower_k := 11
-    upper_k := 16
     all_results := map[string]interface{}{}
-
-    for i := lower_k; i <= upper_k; i++ {
-        tableName := fmt.Sprintf("neomers_%d", i)
-         // Build the query. Now we join with cancer_type_details and donor_data 
-        // in the same pattern:
-        baseQuery := fmt.Sprintf(`
-        SELECT 
-            c.Cancer_Type ,
-            COUNT(nullomers_created) AS count_neomers
-        FROM %s n
-        JOIN cancer_type_details c USING (Project_Code)
-        GROUP BY Cancer_Type
-        `, tableName)
-
-
-        rows, err := db.Query(baseQuery)
+    for _, k := range ks {
+        if k < 11 || k > 16 {
+            continue
+        }
+        rows, err := db.Query(fmt.Sprintf(`
+            SELECT c.Cancer_Type, COUNT(nullomers_created) AS count_neomers
+            FROM neomers_%d n
+            JOIN cancer_type_details c USING (Project_Code)
+            GROUP BY c.Cancer_Type
+            ORDER BY c.Cancer_Type
+        `, k))
         if err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
             return
         }
-        defer rows.Close()
 
         result := []map[string]interface{}{}
         for rows.Next() {
             var cancer_type string
-            var count string
-            if err := rows.Scan(&cancer_type, &count); err == nil {
-                result = append(result, map[string]interface{}{
-                    "cancer_type": cancer_type,
-                    "count":  count,
-                })
+            var count int64
+            if err := rows.Scan(&cancer_type, &count); err != nil {
+                rows.Close()
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
             }
+            result = append(result, map[string]interface{}{
+                "cancer_type": cancer_type,
+                "count":       count,
+            })
         }
-        all_results[strconv.Itoa(i)] = result
-
+        err = rows.Err()
+        rows.Close()
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        all_results[strconv.Itoa(k)] = result
     }
     c.JSON(http.StatusOK, gin.H{"stats": all_results})
-  
 }
 
 func getDistNeomerKCancerTypes(c *gin.Context) {
@@ -1709,100 +1376,16 @@ func getDistNeomerKOrgans(c *gin.Context) {
 
 // GET /distribution_neomer/:K/data_by_cancer_type?cancerType=...
 // Returns [{ donor_count:int, num_nullomers:int }, …] for a specific cancer type and K.
+// Filters, a cohort or dataset=exome compute it live (see distributionDataHandler).
 func getDistNeomerKDataByCancerType(c *gin.Context) {
-    K := c.Param("K")
-    if _, err := strconv.Atoi(K); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter K must be an integer"})
-        return
-    }
-    ct := c.Query("cancerType")
-    if ct == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing cancerType query parameter"})
-        return
-    }
-
-    tableName := fmt.Sprintf("distribution_neomer_%s_per_cancer", K)
-    stmt := fmt.Sprintf(`
-      SELECT donor_count, num_nullomers
-      FROM %s
-      WHERE Cancer_Type = ?
-      ORDER BY donor_count
-    `, tableName)
-
-    rows, err := db.Query(stmt, ct)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Query failed, possibly no data for K=%s: %v", K, err)})
-        return
-    }
-    defer rows.Close()
-
-    type bucket struct {
-        DonorCount   int64 `json:"donorCount"`
-        NumNullomers int64 `json:"numNullomers"`
-    }
-    var data []bucket
-    for rows.Next() {
-        var b bucket
-        if err := rows.Scan(&b.DonorCount, &b.NumNullomers); err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-        data = append(data, b)
-    }
-    c.JSON(http.StatusOK, gin.H{
-        "K":            K,
-        "cancerType":   ct,
-        "distribution": data,
-    })
+    distributionDataHandler(c, "cancerType", "Cancer_Type", "cancer")
 }
 
 // GET /distribution_neomer/:K/data_by_organ?organ=...
 // Returns [{ donor_count:int, num_nullomers:int }, …] for a specific organ and K.
+// Filters, a cohort or dataset=exome compute it live (see distributionDataHandler).
 func getDistNeomerKDataByOrgan(c *gin.Context) {
-    K := c.Param("K")
-    if _, err := strconv.Atoi(K); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter K must be an integer"})
-        return
-    }
-    organ := c.Query("organ")
-    if organ == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing organ query parameter"})
-        return
-    }
-
-    tableName := fmt.Sprintf("distribution_neomer_%s_per_organ", K)
-    stmt := fmt.Sprintf(`
-      SELECT donor_count, num_nullomers
-      FROM %s
-      WHERE Organ = ?
-      ORDER BY donor_count
-    `, tableName)
-
-    rows, err := db.Query(stmt, organ)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Query failed, possibly no data for K=%s: %v", K, err)})
-        return
-    }
-    defer rows.Close()
-
-    type bucket struct {
-        DonorCount   int64 `json:"donorCount"`
-        NumNullomers int64 `json:"numNullomers"`
-    }
-    var data []bucket
-    for rows.Next() {
-        var b bucket
-        if err := rows.Scan(&b.DonorCount, &b.NumNullomers); err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-        data = append(data, b)
-    }
-    c.JSON(http.StatusOK, gin.H{
-        "K":            K,
-        "organ":        organ,
-        "distribution": data,
-    })
+    distributionDataHandler(c, "organ", "Organ", "organ")
 }
 
 // GET /exome_patient_details?donor_id=…
@@ -1944,6 +1527,16 @@ func getExomeAnalyzeNeomerHandler(c *gin.Context) {
 	
 	tableName := fmt.Sprintf("exome_neomers_%d", length)
 
+	// Optional saved cohort
+	cohortWhere, cohortArgs, ok := cohortDonorClause(c, "exome", "di.Actual_Donor_ID")
+	if !ok {
+		return
+	}
+	if cohortWhere != "" {
+		cohortWhere = "AND " + cohortWhere
+	}
+	args := append([]interface{}{neomer}, cohortArgs...)
+
 	// 1) Cancer Type breakdown
 	cancerQ := fmt.Sprintf(`
 		SELECT d.Cancer_Type    AS cancerType,
@@ -1954,11 +1547,12 @@ func getExomeAnalyzeNeomerHandler(c *gin.Context) {
 		JOIN exome_donor_data AS d
 			ON di.Actual_Donor_ID = d.bcr_patient_barcode
 		WHERE n.nullomers_created = ?
+		%s
 		GROUP BY d.Cancer_Type
 		ORDER BY count DESC
-	`, tableName)
+	`, tableName, cohortWhere)
 
-	cancerRows, err := db.Query(cancerQ, neomer)
+	cancerRows, err := db.Query(cancerQ, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cancer breakdown: " + err.Error()})
 		return
@@ -1994,11 +1588,12 @@ func getExomeAnalyzeNeomerHandler(c *gin.Context) {
 		JOIN exome_donor_data AS d
 			ON di.Actual_Donor_ID = d.bcr_patient_barcode
 		WHERE n.nullomers_created = ?
+		%s
 		GROUP BY d.Organ
 		ORDER BY count DESC
-	`, tableName)
+	`, tableName, cohortWhere)
 
-	organRows, err := db.Query(organQ, neomer)
+	organRows, err := db.Query(organQ, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching organ breakdown: " + err.Error()})
 		return
@@ -2030,9 +1625,10 @@ func getExomeAnalyzeNeomerHandler(c *gin.Context) {
 		FROM %s AS n
 		JOIN exomes_donor_id_mapping AS di ON n.Donor_ID = di.Donor_ID
 		WHERE n.nullomers_created = ?
-	`, tableName)
+		%s
+	`, tableName, cohortWhere)
 
-	exomeDonorRows, err := db.Query(distinctDonorIDsQueryExome, neomer)
+	exomeDonorRows, err := db.Query(distinctDonorIDsQueryExome, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching distinct exome donor IDs: " + err.Error()})
 		return
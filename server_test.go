@@ -0,0 +1,50 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+)
+
+// useTestDB points the global db at a fresh in-memory database built
+// from the statements, and restores the previous one after the test.
+func useTestDB(t *testing.T, stmts ...string) {
+    t.Helper()
+    testDB, err := sql.Open("duckdb", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, stmt := range stmts {
+        if _, err := testDB.Exec(stmt); err != nil {
+            testDB.Close()
+            t.Fatalf("%s: %v", stmt, err)
+        }
+    }
+    previous := db
+    db = testDB
+    t.Cleanup(func() {
+        db = previous
+        testDB.Close()
+    })
+}
+
+// serveJSON runs the handler on a GET of target and decodes the body
+// into out.
+func serveJSON(t *testing.T, h gin.HandlerFunc, target string, out interface{}) {
+    t.Helper()
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+    h(c)
+    if w.Code != http.StatusOK {
+        t.Fatalf("GET %s: status %d: %s", target, w.Code, w.Body.String())
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+        t.Fatalf("GET %s: %v", target, err)
+    }
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+    "math"
+    "sort"
+)
+
+// ------------------------------------------------------------------
+// Statistics helpers
+// ------------------------------------------------------------------
+
+// logChoose returns log(n choose k).
+func logChoose(n, k int64) float64 {
+    if k < 0 || k > n {
+        return math.Inf(-1)
+    }
+    a, _ := math.Lgamma(float64(n + 1))
+    b, _ := math.Lgamma(float64(k + 1))
+    c, _ := math.Lgamma(float64(n - k + 1))
+    return a - b - c
+}
+
+// hypergeomTails returns P(X <= x) and P(X >= x) for X ~ Hypergeometric
+// drawing n items from a population of N containing K successes.
+// These are the one-sided Fisher exact test p-values of a 2x2 table
+// with a = x, row total K, column total n and grand total N.
+func hypergeomTails(x, N, K, n int64) (lower, upper float64) {
+    lo := n + K - N
+    if lo < 0 {
+        lo = 0
+    }
+    hi := n
+    if K < hi {
+        hi = K
+    }
+    denom := logChoose(N, n)
+    for i := lo; i <= hi; i++ {
+        p := math.Exp(logChoose(K, i) + logChoose(N-K, n-i) - denom)
+        if i <= x {
+            lower += p
+        }
+        if i >= x {
+            upper += p
+        }
+    }
+    return math.Min(lower, 1), math.Min(upper, 1)
+}
+
+// logOddsRatio returns the natural log odds ratio of the 2x2 table with
+// a = x, row total K, column total n and grand total N, using the
+// Haldane-Anscombe correction (+0.5 per cell) so it stays finite.
+func logOddsRatio(x, N, K, n int64) float64 {
+    a := float64(x) + 0.5
+    b := float64(K-x) + 0.5
+    c := float64(n-x) + 0.5
+    d := float64(N-K-n+x) + 0.5
+    return math.Log(a * d / (b * c))
+}
+
+// percentile returns the p-quantile (0..1) of sorted values using
+// linear interpolation between closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+    if len(sorted) == 0 {
+        return math.NaN()
+    }
+    pos := p * float64(len(sorted)-1)
+    lo := int(math.Floor(pos))
+    hi := int(math.Ceil(pos))
+    return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+// fisherTwoSided returns the two-sided Fisher exact test p-value of the
+// same 2x2 table as hypergeomTails: the total probability of all tables
+// with the same margins that are no more likely than the observed one.
+func fisherTwoSided(x, N, K, n int64) float64 {
+    lo := n + K - N
+    if lo < 0 {
+        lo = 0
+    }
+    hi := n
+    if K < hi {
+        hi = K
+    }
+    denom := logChoose(N, n)
+    observed := logChoose(K, x) + logChoose(N-K, n-x) - denom
+    p := 0.0
+    for i := lo; i <= hi; i++ {
+        lp := logChoose(K, i) + logChoose(N-K, n-i) - denom
+        if lp <= observed+1e-7 {
+            p += math.Exp(lp)
+        }
+    }
+    return math.Min(p, 1)
+}
+
+// benjaminiHochberg returns the Benjamini-Hochberg adjusted p-values
+// (FDR q-values) of pvalues, in the same order.
+func benjaminiHochberg(pvalues []float64) []float64 {
+    m := len(pvalues)
+    order := make([]int, m)
+    for i := range order {
+        order[i] = i
+    }
+    sort.Slice(order, func(i, j int) bool { return pvalues[order[i]] < pvalues[order[j]] })
+    q := make([]float64, m)
+    running := 1.0
+    for r := m - 1; r >= 0; r-- {
+        i := order[r]
+        running = math.Min(running, pvalues[i]*float64(m)/float64(r+1))
+        q[i] = running
+    }
+    return q
+}
+
+// ksPValue returns the asymptotic p-value of a two-sample
+// Kolmogorov-Smirnov statistic d for samples of sizes n1 and n2, using
+// Stephens' small-sample correction of the effective size. For discrete
+// data (ties) it is conservative.
+func ksPValue(d float64, n1, n2 int64) float64 {
+    if n1 == 0 || n2 == 0 {
+        return math.NaN()
+    }
+    ne := float64(n1) * float64(n2) / float64(n1+n2)
+    lambda := (math.Sqrt(ne) + 0.12 + 0.11/math.Sqrt(ne)) * d
+    if lambda < 1e-3 {
+        return 1
+    }
+    // Q_KS(lambda) = 2 sum_{j>=1} (-1)^(j-1) exp(-2 j^2 lambda^2)
+    sum, sign := 0.0, 1.0
+    for j := 1; j <= 100; j++ {
+        term := sign * 2 * math.Exp(-2*float64(j*j)*lambda*lambda)
+        sum += term
+        if math.Abs(term) < 1e-12 {
+            break
+        }
+        sign = -sign
+    }
+    return math.Max(0, math.Min(1, sum))
+}
+
+// regularizedBeta returns the regularized incomplete beta function
+// I_x(a, b), evaluated by its continued fraction (Lentz's method).
+func regularizedBeta(a, b, x float64) float64 {
+    if x <= 0 {
+        return 0
+    }
+    if x >= 1 {
+        return 1
+    }
+    la, _ := math.Lgamma(a)
+    lb, _ := math.Lgamma(b)
+    lab, _ := math.Lgamma(a + b)
+    front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+    if x < (a+1)/(a+b+2) {
+        return front * betaContinuedFraction(a, b, x) / a
+    }
+    return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+func betaContinuedFraction(a, b, x float64) float64 {
+    const eps, tiny = 1e-14, 1e-300
+    clamp := func(v float64) float64 {
+        if math.Abs(v) < tiny {
+            return tiny
+        }
+        return v
+    }
+    c, d := 1.0, 1/clamp(1-(a+b)*x/(a+1))
+    h := d
+    for m := 1.0; m <= 300; m++ {
+        aa := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+        d = 1 / clamp(1+aa*d)
+        c = clamp(1 + aa/c)
+        h *= d * c
+        aa = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+        d = 1 / clamp(1+aa*d)
+        c = clamp(1 + aa/c)
+        del := d * c
+        h *= del
+        if math.Abs(del-1) < eps {
+            break
+        }
+    }
+    return h
+}
+
+// regularizedGammaQ returns the upper regularized incomplete gamma
+// function Q(a, x), by its series for x < a+1 and its continued
+// fraction otherwise.
+func regularizedGammaQ(a, x float64) float64 {
+    const eps, tiny = 1e-14, 1e-300
+    if x <= 0 {
+        return 1
+    }
+    lg, _ := math.Lgamma(a)
+    scale := math.Exp(-x + a*math.Log(x) - lg)
+    if x < a+1 {
+        sum := 1 / a
+        del, ap := sum, a
+        for n := 0; n < 500; n++ {
+            ap++
+            del *= x / ap
+            sum += del
+            if math.Abs(del) < math.Abs(sum)*eps {
+                break
+            }
+        }
+        return math.Max(0, 1-sum*scale)
+    }
+    b := x + 1 - a
+    c, d := 1/tiny, 1/b
+    h := d
+    for i := 1.0; i <= 500; i++ {
+        an := -i * (i - a)
+        b += 2
+        d = an*d + b
+        if math.Abs(d) < tiny {
+            d = tiny
+        }
+        c = b + an/c
+        if math.Abs(c) < tiny {
+            c = tiny
+        }
+        d = 1 / d
+        del := d * c
+        h *= del
+        if math.Abs(del-1) < eps {
+            break
+        }
+    }
+    return scale * h
+}
+
+// midRanks returns the 1-based ranks of values with ties given their
+// average rank, and the tie term sum(t^3 - t) over groups of t ties.
+func midRanks(values []float64) ([]float64, float64) {
+    order := make([]int, len(values))
+    for i := range order {
+        order[i] = i
+    }
+    sort.Slice(order, func(i, j int) bool { return values[order[i]] < values[order[j]] })
+    ranks := make([]float64, len(values))
+    ties := 0.0
+    for i := 0; i < len(order); {
+        j := i
+        for j+1 < len(order) && values[order[j+1]] == values[order[i]] {
+            j++
+        }
+        rank := float64(i+j)/2 + 1
+        for r := i; r <= j; r++ {
+            ranks[order[r]] = rank
+        }
+        t := float64(j - i + 1)
+        ties += t*t*t - t
+        i = j + 1
+    }
+    return ranks, ties
+}
+
+// spearmanTest returns Spearman's rank correlation of x and y and its
+// two-sided p-value from the t approximation with n-2 degrees of
+// freedom. rho is NaN when either variable is constant.
+func spearmanTest(x, y []float64) (rho, p float64) {
+    n := float64(len(x))
+    if len(x) < 3 {
+        return math.NaN(), math.NaN()
+    }
+    rx, _ := midRanks(x)
+    ry, _ := midRanks(y)
+    mean := (n + 1) / 2
+    var sxy, sxx, syy float64
+    for i := range rx {
+        dx, dy := rx[i]-mean, ry[i]-mean
+        sxy += dx * dy
+        sxx += dx * dx
+        syy += dy * dy
+    }
+    if sxx == 0 || syy == 0 {
+        return math.NaN(), math.NaN()
+    }
+    rho = sxy / math.Sqrt(sxx*syy)
+    if math.Abs(rho) >= 1 {
+        return rho, 0
+    }
+    df := n - 2
+    t := rho * math.Sqrt(df/(1-rho*rho))
+    return rho, regularizedBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// mannWhitneyTest returns the Mann-Whitney U of sample a against b, the
+// rank-biserial correlation (positive when a tends to be larger) and
+// the two-sided p-value of the normal approximation with tie and
+// continuity corrections.
+func mannWhitneyTest(a, b []float64) (u, r, p float64) {
+    n1, n2 := float64(len(a)), float64(len(b))
+    if n1 == 0 || n2 == 0 {
+        return math.NaN(), math.NaN(), math.NaN()
+    }
+    ranks, ties := midRanks(append(append([]float64{}, a...), b...))
+    r1 := 0.0
+    for _, rk := range ranks[:len(a)] {
+        r1 += rk
+    }
+    u = r1 - n1*(n1+1)/2
+    r = 2*u/(n1*n2) - 1
+    n := n1 + n2
+    sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+    if sigma == 0 {
+        return u, r, 1
+    }
+    z := math.Max(math.Abs(u-n1*n2/2)-0.5, 0) / sigma
+    return u, r, math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// kruskalWallisTest returns the tie-corrected Kruskal-Wallis H of the
+// groups, its effect size epsilon-squared H / (n - 1), and the p-value
+// of the chi-squared approximation with k-1 degrees of freedom.
+func kruskalWallisTest(groups [][]float64) (h, epsilonSquared, p float64) {
+    var all []float64
+    for _, g := range groups {
+        all = append(all, g...)
+    }
+    n, k := float64(len(all)), float64(len(groups))
+    if k < 2 || n < 3 {
+        return math.NaN(), math.NaN(), math.NaN()
+    }
+    ranks, ties := midRanks(all)
+    start := 0
+    for _, g := range groups {
+        sum := 0.0
+        for _, rk := range ranks[start : start+len(g)] {
+            sum += rk
+        }
+        if len(g) > 0 {
+            h += sum * sum / float64(len(g))
+        }
+        start += len(g)
+    }
+    h = 12/(n*(n+1))*h - 3*(n+1)
+    correction := 1 - ties/(n*n*n-n)
+    if correction == 0 {
+        return 0, 0, 1
+    }
+    h /= correction
+    return h, h / (n - 1), regularizedGammaQ((k-1)/2, h/2)
+}
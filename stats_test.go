@@ -0,0 +1,145 @@
+package main
+
+import (
+    "math"
+    "testing"
+)
+
+func almostEqual(t *testing.T, name string, got, want, tol float64) {
+    t.Helper()
+    if math.IsNaN(got) || math.Abs(got-want) > tol {
+        t.Errorf("%s = %v, want %v", name, got, want)
+    }
+}
+
+func TestMidRanks(t *testing.T) {
+    ranks, ties := midRanks([]float64{20, 10, 30, 20})
+    want := []float64{2.5, 1, 4, 2.5}
+    for i := range want {
+        almostEqual(t, "rank", ranks[i], want[i], 0)
+    }
+    almostEqual(t, "ties", ties, 6, 0)
+}
+
+func TestSpecialFunctions(t *testing.T) {
+    // Two-sided Student t p-value, t = 2 with 10 degrees of freedom
+    almostEqual(t, "regularizedBeta", regularizedBeta(5, 0.5, 10.0/14), 0.0733880347707, 1e-10)
+    // Chi-squared survival with 2 degrees of freedom is exp(-x/2)
+    almostEqual(t, "regularizedGammaQ", regularizedGammaQ(1, 5.991464547/2), math.Exp(-5.991464547/2), 1e-12)
+    // ... and with 1 degree of freedom erfc(sqrt(x/2))
+    almostEqual(t, "regularizedGammaQ", regularizedGammaQ(0.5, 1.5), math.Erfc(math.Sqrt(1.5)), 1e-12)
+}
+
+func TestSpearman(t *testing.T) {
+    rho, p := spearmanTest([]float64{1, 2, 3, 4, 5}, []float64{5, 6, 7, 8, 7})
+    almostEqual(t, "rho", rho, 0.8207826816681233, 1e-12)
+    almostEqual(t, "p", p, 0.0885870053135438, 1e-9)
+
+    rho, p = spearmanTest([]float64{1, 2, 3, 4}, []float64{40, 30, 20, 10})
+    almostEqual(t, "rho", rho, -1, 0)
+    almostEqual(t, "p", p, 0, 0)
+
+    if rho, _ := spearmanTest([]float64{1, 2, 3}, []float64{7, 7, 7}); !math.IsNaN(rho) {
+        t.Errorf("rho of a constant variable = %v, want NaN", rho)
+    }
+}
+
+func TestMannWhitney(t *testing.T) {
+    u, r, p := mannWhitneyTest([]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10})
+    almostEqual(t, "U", u, 0, 0)
+    almostEqual(t, "r", r, -1, 0)
+    // z = (12.5 - 0.5) / sqrt(25 * 11 / 12)
+    almostEqual(t, "p", p, math.Erfc(12/math.Sqrt(275.0/12)/math.Sqrt2), 1e-12)
+    almostEqual(t, "p", p, 0.0121857803553, 1e-10)
+
+    u, r, p = mannWhitneyTest([]float64{6, 7, 8}, []float64{1, 2, 3})
+    almostEqual(t, "U", u, 9, 0)
+    almostEqual(t, "r", r, 1, 0)
+
+    _, _, p = mannWhitneyTest([]float64{2, 2}, []float64{2, 2})
+    almostEqual(t, "p of identical samples", p, 1, 0)
+}
+
+func TestKruskalWallis(t *testing.T) {
+    h, eps, p := kruskalWallisTest([][]float64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}})
+    almostEqual(t, "H", h, 7.2, 1e-12)
+    almostEqual(t, "epsilonSquared", eps, 0.9, 1e-12)
+    almostEqual(t, "p", p, math.Exp(-3.6), 1e-12)
+
+    // With ties: ranks 1.5 1.5 3.5 | 3.5 5.5 5.5, tie correction 1 - 18/210
+    h, _, p = kruskalWallisTest([][]float64{{1, 1, 2}, {2, 3, 3}})
+    almostEqual(t, "H", h, 10.0/3, 1e-12)
+    almostEqual(t, "p", p, math.Erfc(math.Sqrt(5.0/3)), 1e-12)
+}
+
+func TestBenjaminiHochberg(t *testing.T) {
+    q := benjaminiHochberg([]float64{0.01, 0.04, 0.03, 0.2})
+    // p * m / rank = 0.04, 0.06, 0.0533, 0.2, then running minimum from the top
+    want := []float64{0.04, 0.16 / 3, 0.16 / 3, 0.2}
+    for i := range want {
+        almostEqual(t, "q", q[i], want[i], 1e-12)
+    }
+}
+
+func TestHypergeomTails(t *testing.T) {
+    // 2x2 tables [[a, b], [c, d]] as x = a, N = a+b+c+d, K = a+b, n = a+c;
+    // the tails are R's fisher.test p-values with alternative "less" and
+    // "greater"
+    cases := []struct {
+        name          string
+        x, N, K, n    int64
+        less, greater float64
+    }{
+        // fisher.test(TeaTasting), TeaTasting = matrix(c(3, 1, 1, 3), 2)
+        {"tea tasting", 3, 8, 4, 4, 69.0 / 70, 17.0 / 70},
+        // fisher.test(Convictions), Convictions = matrix(c(2, 10, 15, 3), 2)
+        {"convictions", 2, 30, 17, 12, 0.000465180943362905, 0.999984519018686},
+        {"strong enrichment", 10, 100, 20, 20, 0.999920035166657, 0.000647518442456268},
+        // matrix(c(0, 5, 5, 0), 2): one of choose(10, 5) tables
+        {"empty cell", 0, 10, 5, 5, 1.0 / 252, 1},
+    }
+    for _, tc := range cases {
+        lower, upper := hypergeomTails(tc.x, tc.N, tc.K, tc.n)
+        almostEqual(t, tc.name+" less", lower, tc.less, 1e-12)
+        almostEqual(t, tc.name+" greater", upper, tc.greater, 1e-12)
+    }
+}
+
+func TestFisherTwoSided(t *testing.T) {
+    // Arguments as for hypergeomTails; R's fisher.test two-sided p-values
+    cases := []struct {
+        name       string
+        x, N, K, n int64
+        p          float64
+    }{
+        {"tea tasting", 3, 8, 4, 4, 34.0 / 70},
+        {"convictions", 2, 30, 17, 12, 0.000536724119143436},
+        {"strong enrichment", 10, 100, 20, 20, 0.000647518442456268},
+        {"empty cell", 0, 10, 5, 5, 2.0 / 252},
+        {"most likely table", 2, 8, 4, 4, 1},
+    }
+    for _, tc := range cases {
+        almostEqual(t, tc.name, fisherTwoSided(tc.x, tc.N, tc.K, tc.n), tc.p, 1e-12)
+    }
+}
+
+func TestKSPValue(t *testing.T) {
+    // Percentage points of the Kolmogorov distribution,
+    // P(K > lambda) = 0.10, 0.05 and 0.01, reached through Stephens'
+    // effective size sqrt(ne) + 0.12 + 0.11 / sqrt(ne)
+    ne := 40.0 * 60 / 100
+    scale := math.Sqrt(ne) + 0.12 + 0.11/math.Sqrt(ne)
+    for _, tc := range []struct{ lambda, p float64 }{
+        {1.22385, 0.10},
+        {1.35810, 0.05},
+        {1.62762, 0.01},
+        {1, 0.2699996716773546},
+    } {
+        almostEqual(t, "ksPValue", ksPValue(tc.lambda/scale, 40, 60), tc.p, 1e-5)
+    }
+    almostEqual(t, "ksPValue of identical samples", ksPValue(0, 40, 60), 1, 0)
+    almostEqual(t, "ksPValue of disjoint samples", ksPValue(1, 500, 500), 0, 1e-12)
+    if p := ksPValue(0.5, 0, 10); !math.IsNaN(p) {
+        t.Errorf("ksPValue of an empty sample = %v, want NaN", p)
+    }
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ------------------------------------------------------------------
+// Filter suggestions
+// ------------------------------------------------------------------
+//
+// Autocomplete values for the listing endpoints' filter columns. The
+// column must be one of the columns the listing endpoint returns; it
+// is resolved to its table, never interpolated from the request.
+// Values containing the input are ranked prefix matches first, then by
+// the number of neomer rows carrying them.
+//
+// Columns with at most suggestionCacheMaxDistinct values are served
+// from an in-memory value/count list built in the background at
+// startup, kept sorted case-insensitively so that prefix matches are
+// found by binary search; the others are queried on demand.
+
+const suggestionCacheMaxDistinct = 1000
+
+// valueCount is one suggested value with its number of neomer rows.
+type valueCount struct {
+    Value string `json:"value"`
+    Count int64  `json:"count"`
+}
+
+type suggestionKey struct {
+    Dataset string
+    K       int
+    Column  string
+}
+
+// suggestionIndex is the cached value list of one column, ordered by
+// its lower-cased values.
+type suggestionIndex struct {
+    Values []valueCount
+    Lower  []string
+}
+
+var (
+    suggestionMu    sync.RWMutex
+    suggestionCache = map[suggestionKey]*suggestionIndex{}
+)
+
+// newSuggestionIndex sorts values case-insensitively.
+func newSuggestionIndex(values []valueCount) *suggestionIndex {
+    idx := &suggestionIndex{Values: values, Lower: make([]string, len(values))}
+    sort.Slice(values, func(i, j int) bool { return strings.ToLower(values[i].Value) < strings.ToLower(values[j].Value) })
+    for i, v := range values {
+        idx.Lower[i] = strings.ToLower(v.Value)
+    }
+    return idx
+}
+
+// suggestionSource returns the FROM clause joining a neomer table to
+// its donor tables like neomerDonorSourceSQL does, and the qualified
+// expression of every column it offers. Internal Donor_IDs are left out.
+func suggestionSource(dataset string, k int) (string, map[string]string, error) {
+    prefix, err := neomerTablePrefix(dataset)
+    if err != nil {
+        return "", nil, err
+    }
+    table := fmt.Sprintf("%s%d", prefix, k)
+    tables, _ := datasetDonorTables(dataset)
+    from := fmt.Sprintf(`
+        FROM %[1]s n
+        JOIN cancer_type_details c USING (Project_Code)
+        JOIN %[2]s di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
+        LEFT JOIN %[3]s d ON di.Actual_Donor_ID = d.%[4]s
+    `, table, tables.Mapping, tables.Clinical, tables.ClinicalKey)
+    aliases := []struct{ Alias, Table string }{{"n", table}, {"c", "cancer_type_details"}, {"di", tables.Mapping}, {"d", tables.Clinical}}
+    if dataset == "exome" {
+        from = fmt.Sprintf(`
+            FROM %[1]s n
+            JOIN %[2]s di ON CAST(n."Donor_ID" AS INT) = di."Donor_ID"
+            JOIN %[3]s d ON di.Actual_Donor_ID = d.%[4]s
+        `, table, tables.Mapping, tables.Clinical, tables.ClinicalKey)
+        aliases = []struct{ Alias, Table string }{{"n", table}, {"di", tables.Mapping}, {"d", tables.Clinical}}
+    }
+
+    columns := map[string]string{}
+    for _, a := range aliases {
+        cols, err := tableColumns(a.Table)
+        if err != nil {
+            return "", nil, err
+        }
+        if a.Alias == "n" && len(cols) == 0 {
+            return "", nil, fmt.Errorf("no %s table", table)
+        }
+        for col := range cols {
+            if _, seen := columns[col]; !seen && col != "Donor_ID" {
+                columns[col] = fmt.Sprintf(`%s."%s"`, a.Alias, col)
+            }
+        }
+    }
+    return from, columns, nil
+}
+
+// buildSuggestionCache fills suggestionCache for every low-cardinality
+// column of every neomer table of both datasets.
+func buildSuggestionCache() {
+    start := time.Now()
+    cached := 0
+    for _, dataset := range []string{"genome", "exome"} {
+        prefix, _ := neomerTablePrefix(dataset)
+        ks, err := availableKs(prefix)
+        if err != nil {
+            log.Printf("Suggestion cache: %v", err)
+            return
+        }
+        for _, k := range ks {
+            n, err := cacheSuggestionTable(dataset, k)
+            if err != nil {
+                log.Printf("Suggestion cache: %s%d: %v", prefix, k, err)
+                continue
+            }
+            cached += n
+        }
+    }
+    log.Printf("Suggestion cache: %d columns cached (%s)", cached, time.Since(start).Round(time.Millisecond))
+}
+
+func cacheSuggestionTable(dataset string, k int) (int, error) {
+    from, columns, err := suggestionSource(dataset, k)
+    if err != nil {
+        return 0, err
+    }
+    names := make([]string, 0, len(columns))
+    for name := range columns {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    // One pass estimating the cardinality of every column
+    exprs := make([]string, len(names))
+    for i, name := range names {
+        exprs[i] = fmt.Sprintf("approx_count_distinct(%s)", columns[name])
+    }
+    distinct := make([]int64, len(names))
+    ptrs := make([]interface{}, len(names))
+    for i := range distinct {
+        ptrs[i] = &distinct[i]
+    }
+    if err := db.QueryRow(fmt.Sprintf("SELECT %s %s", strings.Join(exprs, ", "), from)).Scan(ptrs...); err != nil {
+        return 0, err
+    }
+
+    cached := 0
+    for i, name := range names {
+        if distinct[i] > suggestionCacheMaxDistinct {
+            continue
+        }
+        values, err := querySuggestionValues(from, columns[name], "", 0)
+        if err != nil {
+            return cached, err
+        }
+        suggestionMu.Lock()
+        suggestionCache[suggestionKey{dataset, k, name}] = newSuggestionIndex(values)
+        suggestionMu.Unlock()
+        cached++
+    }
+    return cached, nil
+}
+
+// querySuggestionValues returns the values of expr containing input
+// (case-insensitively) with their row counts, ranked like
+// rankSuggestions; limit 0 returns every value.
+func querySuggestionValues(from, expr, input string, limit int) ([]valueCount, error) {
+    limitSQL := ""
+    if limit > 0 {
+        limitSQL = fmt.Sprintf("LIMIT %d", limit)
+    }
+    rows, err := db.Query(fmt.Sprintf(`
+        SELECT CAST(%[1]s AS VARCHAR) AS v, COUNT(*) AS cnt
+        %[2]s
+        WHERE %[1]s IS NOT NULL AND contains(lower(CAST(%[1]s AS VARCHAR)), lower(?))
+        GROUP BY v
+        ORDER BY starts_with(lower(v), lower(?)) DESC, cnt DESC, v
+        %[3]s
+    `, expr, from, limitSQL), input, input)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    values := []valueCount{}
+    for rows.Next() {
+        var v valueCount
+        if err := rows.Scan(&v.Value, &v.Count); err != nil {
+            return nil, err
+        }
+        values = append(values, v)
+    }
+    return values, rows.Err()
+}
+
+// rankSuggestions returns the cached values containing input, prefix
+// matches first, each by count, then by value. Prefix matches are a
+// binary-searched range of the index; the other values are scanned for
+// substrings only when the prefix matches do not fill the limit.
+func rankSuggestions(idx *suggestionIndex, input string, limit int) []valueCount {
+    input = strings.ToLower(input)
+    byCount := func(vs []valueCount) {
+        sort.Slice(vs, func(i, j int) bool {
+            if vs[i].Count != vs[j].Count {
+                return vs[i].Count > vs[j].Count
+            }
+            return vs[i].Value < vs[j].Value
+        })
+    }
+    lo := sort.SearchStrings(idx.Lower, input)
+    hi := lo + sort.Search(len(idx.Lower)-lo, func(i int) bool { return !strings.HasPrefix(idx.Lower[lo+i], input) })
+    result := append([]valueCount{}, idx.Values[lo:hi]...)
+    byCount(result)
+    if len(result) >= limit {
+        return result[:limit]
+    }
+
+    var contained []valueCount
+    for i, lower := range idx.Lower {
+        if (i < lo || i >= hi) && strings.Contains(lower, input) {
+            contained = append(contained, idx.Values[i])
+        }
+    }
+    byCount(contained)
+    for i := 0; i < len(contained) && len(result) < limit; i++ {
+        result = append(result, contained[i])
+    }
+    return result
+}
+
+// ------------------------------------------------------------------
+// suggestionsHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /get_suggestions?length=16&column=Hugo_Symbol&input=tp&limit=10
+//           /get_exome_suggestions (same parameters)
+//
+// Returns "suggestions" (the values) and "values" (values with their
+// row counts), plus whether they came from the cache. gc_content is
+// computed per row and has no suggestions.
+//
+func suggestionsHandler(c *gin.Context, dataset string) {
+    k, err := strconv.Atoi(c.Query("length"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required parameter 'length'"})
+        return
+    }
+    column := c.Query("column")
+    if column == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required parameter 'column'"})
+        return
+    }
+    input := c.Query("input")
+    limit := 10
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 100 {
+        limit = l
+    }
+    if column == "gc_content" {
+        c.JSON(http.StatusOK, gin.H{"suggestions": []string{}, "values": []valueCount{}})
+        return
+    }
+
+    suggestionMu.RLock()
+    index, cached := suggestionCache[suggestionKey{dataset, k, column}]
+    suggestionMu.RUnlock()
+
+    var values []valueCount
+    if cached {
+        values = rankSuggestions(index, input, limit)
+    } else {
+        from, columns, err := suggestionSource(dataset, k)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        expr, ok := columns[column]
+        if !ok {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown column '%s'", column)})
+            return
+        }
+        if values, err = querySuggestionValues(from, expr, input, limit); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    suggestions := make([]string, len(values))
+    for i, v := range values {
+        suggestions[i] = v.Value
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "suggestions": suggestions,
+        "values":      values,
+        "cached":      cached,
+    })
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "sync"
+
+    "github.com/gin-gonic/gin"
+)
+
+// trendGroupings maps the "groupBy" values of /trends to columns of
+// neomerSourceSQL.
+var trendGroupings = map[string]string{
+    "cancer_type": "Cancer_Type",
+    "organ":       "Organ",
+    "gene":        "Hugo_Symbol",
+    "donor":       "Actual_Donor_ID",
+}
+
+// trendMeasures maps the "measure" values of /trends to aggregates over
+// the rows of one group. neomers_per_donor is the mean number of
+// distinct neomers of the group's donors.
+var trendMeasures = map[string]string{
+    "rows":              "COUNT(*)",
+    "distinct_neomers":  "COUNT(DISTINCT nullomers_created)",
+    "distinct_donors":   "COUNT(DISTINCT Actual_Donor_ID)",
+    "neomers_per_donor": "COUNT(DISTINCT (Actual_Donor_ID, nullomers_created)) / COUNT(DISTINCT Actual_Donor_ID)",
+}
+
+// trendSeries is the measure of one group at every K of a trend, nil
+// where the group has no rows at that K.
+type trendSeries struct {
+    Group  string     `json:"group"`
+    Values []*float64 `json:"values"`
+    Total  float64    `json:"-"`
+}
+
+// computeTrends evaluates measure per group on every K concurrently and
+// returns one series per group, aligned with ks, ordered by decreasing
+// sum over K (then name).
+func computeTrends(dataset string, ks []int, column, measure string) ([]trendSeries, error) {
+    perK := make([]map[string]float64, len(ks))
+    errs := make([]error, len(ks))
+    var wg sync.WaitGroup
+    for i, k := range ks {
+        wg.Add(1)
+        go func(i, k int) {
+            defer wg.Done()
+            perK[i], errs[i] = trendValues(dataset, k, column, measure)
+        }(i, k)
+    }
+    wg.Wait()
+    for i, err := range errs {
+        if err != nil {
+            return nil, fmt.Errorf("K=%d: %w", ks[i], err)
+        }
+    }
+
+    byGroup := map[string]*trendSeries{}
+    for i, values := range perK {
+        for group, v := range values {
+            s, ok := byGroup[group]
+            if !ok {
+                s = &trendSeries{Group: group, Values: make([]*float64, len(ks))}
+                byGroup[group] = s
+            }
+            v := v
+            s.Values[i] = &v
+            s.Total += v
+        }
+    }
+    series := make([]trendSeries, 0, len(byGroup))
+    for _, s := range byGroup {
+        series = append(series, *s)
+    }
+    sort.Slice(series, func(i, j int) bool {
+        if series[i].Total != series[j].Total {
+            return series[i].Total > series[j].Total
+        }
+        return series[i].Group < series[j].Group
+    })
+    return series, nil
+}
+
+// trendValues evaluates one measure per group on one K.
+func trendValues(dataset string, k int, column, measure string) (map[string]float64, error) {
+    source, err := neomerSourceSQL(dataset, k)
+    if err != nil {
+        return nil, err
+    }
+    rows, err := db.Query(fmt.Sprintf(`
+        SELECT CAST(%[1]s AS VARCHAR) AS grp, CAST(%[2]s AS DOUBLE)
+        FROM (%[3]s)
+        WHERE %[1]s IS NOT NULL
+        GROUP BY grp
+    `, column, trendMeasures[measure], source))
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    values := map[string]float64{}
+    for rows.Next() {
+        var group string
+        var v float64
+        if err := rows.Scan(&group, &v); err != nil {
+            return nil, err
+        }
+        values[group] = v
+    }
+    return values, rows.Err()
+}
+
+// ------------------------------------------------------------------
+// getTrendsHandler
+// ------------------------------------------------------------------
+//
+// Endpoint: /trends?dataset=genome&minK=11&maxK=16&groupBy=cancer_type
+//                   &measure=distinct_neomers&limit=20
+//
+// One numeric series per group across the available K in [minK, maxK]
+// (default: every K), for line charts. groupBy is cancer_type, organ,
+// gene or donor; measure is rows, distinct_neomers, distinct_donors or
+// neomers_per_donor. Series are ordered by their sum over K and cut to
+// the first "limit" (default 50, 0 for all); values are null where a
+// group has no rows at a K. The K tables are queried concurrently.
+//
+func getTrendsHandler(c *gin.Context) {
+    dataset := c.DefaultQuery("dataset", "genome")
+    prefix, err := neomerTablePrefix(dataset)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    groupBy := c.DefaultQuery("groupBy", "cancer_type")
+    column, ok := trendGroupings[groupBy]
+    if !ok {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'groupBy' must be one of cancer_type, organ, gene, donor"})
+        return
+    }
+    measure := c.DefaultQuery("measure", "rows")
+    if _, ok := trendMeasures[measure]; !ok {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'measure' must be one of rows, distinct_neomers, distinct_donors, neomers_per_donor"})
+        return
+    }
+    limit := 50
+    if l, err := strconv.Atoi(c.Query("limit")); err == nil && l >= 0 {
+        limit = l
+    }
+
+    available, err := availableKs(prefix)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    minK, maxK := 0, 1<<30
+    if v := c.Query("minK"); v != "" {
+        if minK, err = strconv.Atoi(v); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'minK' must be an integer"})
+            return
+        }
+    }
+    if v := c.Query("maxK"); v != "" {
+        if maxK, err = strconv.Atoi(v); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter 'maxK' must be an integer"})
+            return
+        }
+    }
+    ks := []int{}
+    for _, k := range available {
+        if k >= minK && k <= maxK {
+            ks = append(ks, k)
+        }
+    }
+    if len(ks) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no %sK tables in range, available K: %v", prefix, available)})
+        return
+    }
+
+    series, err := computeTrends(dataset, ks, column, measure)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    totalGroups := len(series)
+    if limit > 0 && len(series) > limit {
+        series = series[:limit]
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "dataset":     dataset,
+        "groupBy":     groupBy,
+        "measure":     measure,
+        "ks":          ks,
+        "series":      series,
+        "totalGroups": totalGroups,
+    })
+}